@@ -5,6 +5,7 @@ package pakelib
 
 import (
 	"log"
+	"log/slog"
 
 	"github.com/pake-go/pake-lib/config"
 )
@@ -32,3 +33,51 @@ type CommandValidator interface {
 	// arguments for the command and returns an error if it is not.
 	ValidateArgs([]string) error
 }
+
+// ResourceUser is an optional interface for commands that may be executed at the same time as
+// other commands.  Commands that do not satisfy it are always executed on their own.
+type ResourceUser interface {
+	// Resources returns the names of the resources, such as files or devices, that the
+	// command uses.  Commands that share a resource are never executed at the same time.
+	Resources() []string
+}
+
+// ConfigResource is the resource that commands which change the Config must return from
+// Resources.  Commands using it are executed on their own, like commands that do not satisfy
+// ResourceUser, so that the commands after them see their changes.
+const ConfigResource = "config"
+
+// FileUser is an optional interface for commands that read and write files, allowing the
+// executor to skip them when their outputs are up to date.
+type FileUser interface {
+	// Inputs returns the names of the files the command reads.
+	Inputs() []string
+	// Outputs returns the names of the files the command writes.
+	Outputs() []string
+}
+
+// Fingerprinter is an optional interface for commands that implement FileUser, allowing them
+// to decide what makes two of their invocations the same for the content hashes stored by the
+// executor.  Commands that do not satisfy it are identified by their type and the Go syntax
+// representation of their value, so commands holding state that changes as they are executed
+// should satisfy it.
+type Fingerprinter interface {
+	// Fingerprint returns a string that changes whenever the arguments of the command change.
+	Fingerprint() string
+}
+
+// StructuredCommand is an optional interface for commands that write structured records with
+// log/slog.  When the executor has a structured logger, it calls ExecuteStructured instead of
+// Execute.
+type StructuredCommand interface {
+	// ExecuteStructured would perform the action behind the command, logging to the given
+	// structured logger.
+	ExecuteStructured(*config.Config, *slog.Logger) error
+}
+
+// Undoer is an optional interface for commands whose effects can be reverted, allowing the
+// executor to roll back a script that failed part of the way through.
+type Undoer interface {
+	// Undo would revert the action performed by Execute.
+	Undo(*config.Config, *log.Logger) error
+}
@@ -15,6 +15,12 @@ func (c *Comment) Execute(cfg *config.Config, logger *log.Logger) error {
 	return nil
 }
 
+// Resources returns nil because comments do not use any resources, allowing the commands
+// around them to be executed at the same time.
+func (c *Comment) Resources() []string {
+	return nil
+}
+
 // CommentValidator is an interface that the comment validator for the language
 // must satisfy.
 type CommentValidator interface {
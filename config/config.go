@@ -2,31 +2,55 @@
 // behavior.
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 // A Config represents a language's configuration, allowing you to change
-// the behavior of the language during runtime.
+// the behavior of the language during runtime.  A Config is safe for
+// concurrent use by multiple goroutines.
 type Config struct {
+	// Mu guards every field below.
+	mu sync.RWMutex
 	// Current represents the current state of the configuration.
 	current map[string]string
-	// Old represents the previous state of the configuration.
+	// Old represents the permanent value of each key whose value is currently
+	// overridden by a temporary value.
 	old map[string]string
-	// SetTemporarilyAgeTracker tracks how many SmartReset() calls were
-	// made for each key whose value was modified by SetTemporarily().
-	setTemporarilyAgeTracker map[string]int
+	// Temporaries represents the stack of temporary values of each key, ordered
+	// from the oldest to the most recent.
+	temporaries map[string][]*temporary
 	// How many SmartReset() calls may be called before a flag that is set
 	// temporarily is cleared.
 	setTemporarilyAge int
+	// Flags represents the declared flags, keyed by name.
+	flags map[string]Flag
+	// Observers represents the functions subscribed to changes, keyed by the id
+	// returned to the subscriber.
+	observers map[int]func(Change)
+	// NextObserverID represents the id given to the next subscriber.
+	nextObserverID int
+	// Pending represents the changes that have not been published to the observers.
+	pending []Change
+	// Source represents the label recorded with every change, such as the position of
+	// the command being executed.
+	source string
+	// Scopes represents the state of the enclosing scopes, ordered from the outermost
+	// scope to the innermost one.  The fields above always hold the state of the
+	// innermost scope.
+	scopes []*scope
 }
 
 // New returns a Config which allows you to change the behavior of the language
 // during runtime by retrieving and setting flags.
 func New() *Config {
 	return &Config{
-		current:                  make(map[string]string),
-		old:                      make(map[string]string),
-		setTemporarilyAgeTracker: make(map[string]int),
-		setTemporarilyAge:        1,
+		current:           make(map[string]string),
+		old:               make(map[string]string),
+		temporaries:       make(map[string][]*temporary),
+		setTemporarilyAge: 1,
+		flags:             make(map[string]Flag),
 	}
 }
 
@@ -37,57 +61,176 @@ func WithSetTemporarilyAge(age int) *Config {
 	return c
 }
 
-// Get attempts to retrieve a value based on the given key.  It returns the value if
-// the key is found and an error if the key is not found.
+// Get attempts to retrieve a value based on the given key, looking in the innermost
+// scope first and then in each enclosing scope.  A namespaced key such as "git.verbose"
+// falls back to the keys of the enclosing namespaces, "verbose" in this case, if it has
+// not been set.  It returns the value if the key is found, the default value if the key
+// is a declared flag with a default and an error otherwise.
 func (c *Config) Get(key string) (string, error) {
-	if val, ok := c.current[key]; ok {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.get(key)
+}
+
+// get is the same as Get but expects the caller to hold the lock.
+func (c *Config) get(key string) (string, error) {
+	if val, ok := lookup(key, c.value, c.flags); ok {
 		return val, nil
 	}
 	return "", fmt.Errorf("Can't find value for %s", key)
 }
 
+// value returns the value set for exactly the given key in the innermost scope that has
+// one.  The caller must hold the lock.
+func (c *Config) value(key string) (string, bool) {
+	if val, ok := c.current[key]; ok {
+		return val, true
+	}
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if val, ok := c.scopes[i].current[key]; ok {
+			return val, true
+		}
+	}
+	return "", false
+}
+
 // SetTemporarily sets the value of the given key until SmartReset() has been called
-// setTemporarilyAge times.
-func (c *Config) SetTemporarily(key, value string) {
-	if oldValue, ok := c.current[key]; ok {
-		c.old[key] = oldValue
+// setTemporarilyAge times.  It returns an error if the key or value is rejected by
+// the declared flags.
+func (c *Config) SetTemporarily(key, value string) error {
+	defer c.publish()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setFor(key, value, c.setTemporarilyAge)
+}
+
+// SetFor sets the value of the given key so that it survives n calls to SmartReset() and
+// is cleared by the next one.  Temporary values of the same key stack: once a temporary
+// value expires, the key reverts to the most recent temporary value that has not expired
+// yet, or to its permanent value if there is none.  It returns an error if n is negative
+// or if the key or value is rejected by the declared flags.
+func (c *Config) SetFor(key, value string, n int) error {
+	defer c.publish()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setFor(key, value, n)
+}
+
+// setFor is the same as SetFor but expects the caller to hold the lock.
+func (c *Config) setFor(key, value string, n int) error {
+	if n < 0 {
+		return fmt.Errorf("Can't set %s for a negative number of commands", key)
+	}
+	if err := c.validate(key, value); err != nil {
+		return err
+	}
+	before, _ := c.get(key)
+	if _, ok := c.temporaries[key]; !ok {
+		if oldValue, ok := c.current[key]; ok {
+			c.old[key] = oldValue
+		}
 	}
 	c.current[key] = value
-	c.setTemporarilyAgeTracker[key] = 0
+	c.temporaries[key] = append(c.temporaries[key], &temporary{value: value, ttl: n})
+	c.record(key, before, CauseTemporary)
+	return nil
 }
 
 // SetPermanently sets the value of the given key until a new value has been specified
-// for the given key.
-func (c *Config) SetPermanently(key, value string) {
+// for the given key.  Setting a key permanently discards any temporary values of the
+// key, so the new value is visible immediately and survives SmartReset().  It returns
+// an error if the key or value is rejected by the declared flags.
+func (c *Config) SetPermanently(key, value string) error {
+	defer c.publish()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.validate(key, value); err != nil {
+		return err
+	}
+	before, _ := c.get(key)
+	delete(c.temporaries, key)
+	delete(c.old, key)
 	c.current[key] = value
+	c.record(key, before, CausePermanent)
+	return nil
 }
 
 // Reset would clear the effect of the SetTemporarily regardless of how many SmartReset()
 // calls has been done.
 func (c *Config) Reset() {
-	for key, _ := range c.setTemporarilyAgeTracker {
-		delete(c.current, key)
+	defer c.publish()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.temporaries {
+		before, _ := c.get(key)
+		c.restore(key)
+		c.record(key, before, CauseReset)
 	}
-	for name, val := range c.old {
-		c.current[name] = val
+	c.temporaries = make(map[string][]*temporary)
+}
+
+// ResetKey is the same as Reset but only clears the temporary values of the given key.
+func (c *Config) ResetKey(key string) {
+	defer c.publish()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.temporaries[key]; !ok {
+		return
 	}
-	c.old = make(map[string]string)
-	c.setTemporarilyAgeTracker = make(map[string]int)
+	before, _ := c.get(key)
+	c.restore(key)
+	c.record(key, before, CauseReset)
+	delete(c.temporaries, key)
 }
 
 // SmartReset checks to see if a flag that has been set temporarily should be cleared
 // before clearing it.  This is meant to be ran every time a command has finished
 // executing.
 func (c *Config) SmartReset() {
-	for key, age := range c.setTemporarilyAgeTracker {
-		if age >= c.setTemporarilyAge {
-			delete(c.current, key)
-			delete(c.setTemporarilyAgeTracker, key)
-			if value, ok := c.old[key]; ok {
-				c.current[key] = value
+	defer c.publish()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, stack := range c.temporaries {
+		before, _ := c.get(key)
+		mostRecent := stack[len(stack)-1]
+		remaining := stack[:0]
+		for _, temp := range stack {
+			if temp.age < temp.ttl {
+				temp.age++
+				remaining = append(remaining, temp)
 			}
+		}
+		if len(remaining) == 0 {
+			c.restore(key)
+			delete(c.temporaries, key)
 		} else {
-			c.setTemporarilyAgeTracker[key] += 1
+			c.temporaries[key] = remaining
+			c.current[key] = remaining[len(remaining)-1].value
+		}
+		if len(remaining) == 0 || remaining[len(remaining)-1] != mostRecent {
+			c.record(key, before, CauseExpiry)
 		}
 	}
 }
+
+// restore replaces the temporary value of the given key with its permanent value, or
+// removes the key if it had no permanent value.  The caller must hold the lock.
+func (c *Config) restore(key string) {
+	if value, ok := c.old[key]; ok {
+		c.current[key] = value
+		delete(c.old, key)
+	} else {
+		delete(c.current, key)
+	}
+}
+
+// A temporary represents a value set by SetTemporarily() or SetFor().
+type temporary struct {
+	// Value represents the temporary value of the key.
+	value string
+	// Age represents how many SmartReset() calls were made since the value was set.
+	age int
+	// TTL represents how many SmartReset() calls may be called before the value is
+	// cleared.
+	ttl int
+}
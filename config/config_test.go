@@ -17,10 +17,10 @@ func TestNew(t *testing.T) {
 		t.Errorf("Expected %+q but got %+q", expectedOld, cfg.old)
 	}
 	expectedSetTempAgeTracker := make(map[string]int)
-	if !reflect.DeepEqual(cfg.setTemporarilyAgeTracker, expectedSetTempAgeTracker) {
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
 		t.Errorf("Expected %+q but got %+q",
 			expectedSetTempAgeTracker,
-			cfg.setTemporarilyAgeTracker)
+			temporaryAges(cfg))
 	}
 	expectedSetTemporarilyAge := 1
 	if cfg.setTemporarilyAge != expectedSetTemporarilyAge {
@@ -42,10 +42,10 @@ func TestWithSetTemporarily(t *testing.T) {
 		t.Errorf("Expected %+q but got %+q", expectedOld, cfg.old)
 	}
 	expectedSetTempAgeTracker := make(map[string]int)
-	if !reflect.DeepEqual(cfg.setTemporarilyAgeTracker, expectedSetTempAgeTracker) {
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
 		t.Errorf("Expected %+q but got %+q",
 			expectedSetTempAgeTracker,
-			cfg.setTemporarilyAgeTracker)
+			temporaryAges(cfg))
 	}
 	expectedSetTemporarilyAge := 3
 	if cfg.setTemporarilyAge != expectedSetTemporarilyAge {
@@ -167,6 +167,22 @@ func TestReset_settemporarilydone(t *testing.T) {
 	}
 }
 
+func TestResetKey(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("key", "permanent")
+	cfg.SetTemporarily("key", "temporary")
+	cfg.SetTemporarily("other", "temporary")
+	cfg.ResetKey("key")
+
+	expectedCurrent := map[string]string{"key": "permanent", "other": "temporary"}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+	if _, ok := cfg.temporaries["key"]; ok {
+		t.Error("Expected the temporary values of key to be cleared")
+	}
+}
+
 func TestReset_setpermanentlydone(t *testing.T) {
 	cfg := New()
 	cfg.SetPermanently("key", "value")
@@ -385,11 +401,11 @@ func TestSmartReset_settemporarilymultiple(t *testing.T) {
 	}
 	expectedSetTempAgeTracker := make(map[string]int)
 	expectedSetTempAgeTracker["key"] = 0
-	if !reflect.DeepEqual(cfg.setTemporarilyAgeTracker, expectedSetTempAgeTracker) {
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
 		t.Errorf(
 			"Expected %+q but got %+q",
 			expectedSetTempAgeTracker,
-			cfg.setTemporarilyAgeTracker,
+			temporaryAges(cfg),
 		)
 	}
 
@@ -405,11 +421,11 @@ func TestSmartReset_settemporarilymultiple(t *testing.T) {
 	}
 	expectedSetTempAgeTracker = make(map[string]int)
 	expectedSetTempAgeTracker["key"] = 1
-	if !reflect.DeepEqual(cfg.setTemporarilyAgeTracker, expectedSetTempAgeTracker) {
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
 		t.Errorf(
 			"Expected %+q but got %+q",
 			expectedSetTempAgeTracker,
-			cfg.setTemporarilyAgeTracker,
+			temporaryAges(cfg),
 		)
 	}
 
@@ -427,11 +443,11 @@ func TestSmartReset_settemporarilymultiple(t *testing.T) {
 	expectedSetTempAgeTracker = make(map[string]int)
 	expectedSetTempAgeTracker["key"] = 1
 	expectedSetTempAgeTracker["key2"] = 0
-	if !reflect.DeepEqual(cfg.setTemporarilyAgeTracker, expectedSetTempAgeTracker) {
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
 		t.Errorf(
 			"Expected %+q but got %+q",
 			expectedSetTempAgeTracker,
-			cfg.setTemporarilyAgeTracker,
+			temporaryAges(cfg),
 		)
 	}
 
@@ -449,11 +465,11 @@ func TestSmartReset_settemporarilymultiple(t *testing.T) {
 	expectedSetTempAgeTracker = make(map[string]int)
 	expectedSetTempAgeTracker["key"] = 2
 	expectedSetTempAgeTracker["key2"] = 1
-	if !reflect.DeepEqual(cfg.setTemporarilyAgeTracker, expectedSetTempAgeTracker) {
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
 		t.Errorf(
 			"Expected %+q but got %+q",
 			expectedSetTempAgeTracker,
-			cfg.setTemporarilyAgeTracker,
+			temporaryAges(cfg),
 		)
 	}
 
@@ -469,11 +485,127 @@ func TestSmartReset_settemporarilymultiple(t *testing.T) {
 	}
 	expectedSetTempAgeTracker = make(map[string]int)
 	expectedSetTempAgeTracker["key2"] = 2
-	if !reflect.DeepEqual(cfg.setTemporarilyAgeTracker, expectedSetTempAgeTracker) {
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
 		t.Errorf(
 			"Expected %+q but got %+q",
 			expectedSetTempAgeTracker,
-			cfg.setTemporarilyAgeTracker,
+			temporaryAges(cfg),
 		)
 	}
 }
+
+func TestSetFor_perkeyttl(t *testing.T) {
+	cfg := New()
+	cfg.SetFor("short", "value", 0)
+	cfg.SetFor("long", "value", 2)
+
+	cfg.SmartReset()
+	expectedCurrent := make(map[string]string)
+	expectedCurrent["long"] = "value"
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+
+	cfg.SmartReset()
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+
+	cfg.SmartReset()
+	expectedCurrent = make(map[string]string)
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestSetFor_negativettl(t *testing.T) {
+	cfg := New()
+
+	if err := cfg.SetFor("key", "value", -1); err == nil {
+		t.Error("Should not be able to set a value for a negative number of commands")
+	}
+}
+
+func TestSetFor_overlappingrestore(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("key", "permanent")
+	cfg.SetFor("key", "long", 3)
+	cfg.SmartReset()
+	cfg.SetFor("key", "short", 0)
+
+	value, _ := cfg.Get("key")
+	if value != "short" {
+		t.Errorf("Expected short but got %s", value)
+	}
+
+	cfg.SmartReset()
+	value, _ = cfg.Get("key")
+	if value != "long" {
+		t.Errorf("Expected long but got %s", value)
+	}
+
+	cfg.SmartReset()
+	value, _ = cfg.Get("key")
+	if value != "long" {
+		t.Errorf("Expected long but got %s", value)
+	}
+
+	cfg.SmartReset()
+	value, _ = cfg.Get("key")
+	if value != "permanent" {
+		t.Errorf("Expected permanent but got %s", value)
+	}
+	expectedOld := make(map[string]string)
+	if !reflect.DeepEqual(cfg.old, expectedOld) {
+		t.Errorf("Expected %+q but got %+q", expectedOld, cfg.old)
+	}
+}
+
+func TestSetTemporarily_absentkeyrestored(t *testing.T) {
+	cfg := New()
+	cfg.SetTemporarily("key", "first")
+	cfg.SetTemporarily("key", "second")
+
+	cfg.SmartReset()
+	cfg.SmartReset()
+	expectedCurrent := make(map[string]string)
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+	expectedOld := make(map[string]string)
+	if !reflect.DeepEqual(cfg.old, expectedOld) {
+		t.Errorf("Expected %+q but got %+q", expectedOld, cfg.old)
+	}
+}
+
+func TestSetPermanently_overridestemporary(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("key", "original")
+	cfg.SetTemporarily("key", "temporary")
+	cfg.SetPermanently("key", "permanent")
+
+	value, _ := cfg.Get("key")
+	if value != "permanent" {
+		t.Errorf("Expected permanent but got %s", value)
+	}
+
+	cfg.SmartReset()
+	cfg.SmartReset()
+	value, _ = cfg.Get("key")
+	if value != "permanent" {
+		t.Errorf("Expected permanent but got %s", value)
+	}
+	expectedSetTempAgeTracker := make(map[string]int)
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
+		t.Errorf("Expected %+q but got %+q", expectedSetTempAgeTracker, temporaryAges(cfg))
+	}
+}
+
+// temporaryAges returns the age of the most recent temporary value of each key.
+func temporaryAges(cfg *Config) map[string]int {
+	ages := make(map[string]int)
+	for key, stack := range cfg.temporaries {
+		ages[key] = stack[len(stack)-1].age
+	}
+	return ages
+}
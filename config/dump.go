@@ -0,0 +1,180 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// Provenance represents where the value of a key comes from.
+type Provenance int
+
+const (
+	// Permanent values were set by SetPermanently() or loaded from a source.
+	Permanent Provenance = iota
+	// Temporary values were set by SetTemporarily() or SetFor().
+	Temporary
+	// Default values are the defaults of declared flags that have not been set.
+	Default
+)
+
+// String returns a description of the provenance.
+func (p Provenance) String() string {
+	switch p {
+	case Permanent:
+		return "permanent"
+	case Temporary:
+		return "temporary"
+	case Default:
+		return "default"
+	}
+	return fmt.Sprintf("Provenance(%d)", int(p))
+}
+
+// MarshalText encodes the provenance as its description.
+func (p Provenance) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// An Entry describes the value of a key and where it comes from.
+type Entry struct {
+	// Key is the key the value is stored under.
+	Key string `json:"key"`
+	// Value is the value of the key.
+	Value string `json:"value"`
+	// Provenance is where the value comes from.
+	Provenance Provenance `json:"provenance"`
+	// Remaining is how many more SmartReset() calls a temporary value survives, which is
+	// the number of commands it still applies to after the current one.  It is 0 for
+	// permanent values and always written to JSON, so that a temporary value on its last
+	// command keeps its remaining count.
+	Remaining int `json:"remaining"`
+	// Scope is the depth of the scope the value was set in, 0 being the outermost scope.
+	Scope int `json:"scope"`
+}
+
+// describe returns a description of the entry's provenance, such as "temporary, 2 left".
+func (e Entry) describe() string {
+	switch e.Provenance {
+	case Temporary:
+		return fmt.Sprintf("temporary, %d left", e.Remaining)
+	default:
+		return e.Provenance.String()
+	}
+}
+
+// All returns an entry for every key that has a value, sorted by key.  This includes the
+// declared flags with a default that have not been set.
+func (s *Snapshot) All() []Entry {
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	for name, flag := range s.flags {
+		if _, ok := s.entries[name]; !ok && flag.Default != "" {
+			entries = append(entries, Entry{Key: name, Value: flag.Default, Provenance: Default})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// Keys returns the sorted list of keys that have a value.
+func (s *Snapshot) Keys() []string {
+	entries := s.All()
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	return keys
+}
+
+// A Difference describes how the value of a key differs between two snapshots.
+type Difference struct {
+	// Key is the key whose value differs.
+	Key string `json:"key"`
+	// Before is the entry of the key in the first snapshot, or nil if it had no value.
+	Before *Entry `json:"before"`
+	// After is the entry of the key in the second snapshot, or nil if it has no value.
+	After *Entry `json:"after"`
+}
+
+// Diff returns the keys whose value or provenance differ between the snapshot and the other
+// snapshot, sorted by key.  The number of commands left for temporary values is ignored.
+func (s *Snapshot) Diff(other *Snapshot) []Difference {
+	before := entriesByKey(s.All())
+	after := entriesByKey(other.All())
+	var differences []Difference
+	for key, b := range before {
+		a, ok := after[key]
+		if !ok {
+			differences = append(differences, Difference{Key: key, Before: b})
+		} else if a.Value != b.Value || a.Provenance != b.Provenance {
+			differences = append(differences, Difference{Key: key, Before: b, After: a})
+		}
+	}
+	for key, a := range after {
+		if _, ok := before[key]; !ok {
+			differences = append(differences, Difference{Key: key, After: a})
+		}
+	}
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].Key < differences[j].Key
+	})
+	return differences
+}
+
+// entriesByKey returns the given entries keyed by their key.
+func entriesByKey(entries []Entry) map[string]*Entry {
+	byKey := make(map[string]*Entry, len(entries))
+	for i := range entries {
+		byKey[entries[i].Key] = &entries[i]
+	}
+	return byKey
+}
+
+// Dump writes a human readable table of every entry to w.
+func (s *Snapshot) Dump(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, entry := range s.All() {
+		fmt.Fprintf(tw, "%s\t%q\t(%s)\n", entry.Key, entry.Value, entry.describe())
+	}
+	return tw.Flush()
+}
+
+// DumpJSON writes every entry to w as a JSON array.
+func (s *Snapshot) DumpJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s.All())
+}
+
+// All is the same as Snapshot.All for the current values of the Config.
+func (c *Config) All() []Entry {
+	return c.Snapshot().All()
+}
+
+// Keys is the same as Snapshot.Keys for the current values of the Config.
+func (c *Config) Keys() []string {
+	return c.Snapshot().Keys()
+}
+
+// Diff is the same as Snapshot.Diff for the current values of the Config and the other
+// Config.
+func (c *Config) Diff(other *Config) []Difference {
+	return c.Snapshot().Diff(other.Snapshot())
+}
+
+// Dump is the same as Snapshot.Dump for the current values of the Config.
+func (c *Config) Dump(w io.Writer) error {
+	return c.Snapshot().Dump(w)
+}
+
+// DumpJSON is the same as Snapshot.DumpJSON for the current values of the Config.
+func (c *Config) DumpJSON(w io.Writer) error {
+	return c.Snapshot().DumpJSON(w)
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAll_provenance(t *testing.T) {
+	cfg := WithSetTemporarilyAge(3)
+	cfg.Declare(Flag{Name: "color", Type: String, Default: "red"})
+	cfg.Declare(Flag{Name: "name", Type: String})
+	cfg.Declare(Flag{Name: "verbose", Type: Bool})
+	cfg.SetPermanently("name", "pake")
+	cfg.SetTemporarily("verbose", "true")
+	cfg.SmartReset()
+	cfg.PushScope()
+	cfg.SetPermanently("name", "inner")
+
+	expected := []Entry{
+		{Key: "color", Value: "red", Provenance: Default},
+		{Key: "name", Value: "inner", Provenance: Permanent, Scope: 1},
+		{Key: "verbose", Value: "true", Provenance: Temporary, Remaining: 2},
+	}
+	if !reflect.DeepEqual(cfg.All(), expected) {
+		t.Errorf("Expected %+v but got %+v", expected, cfg.All())
+	}
+	expectedKeys := []string{"color", "name", "verbose"}
+	if !reflect.DeepEqual(cfg.Keys(), expectedKeys) {
+		t.Errorf("Expected %+q but got %+q", expectedKeys, cfg.Keys())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("changed", "before")
+	cfg.SetPermanently("removed", "value")
+	cfg.SetPermanently("same", "value")
+	cfg.SetPermanently("provenance", "value")
+	other := New()
+	other.SetPermanently("changed", "after")
+	other.SetPermanently("added", "value")
+	other.SetPermanently("same", "value")
+	other.SetTemporarily("provenance", "value")
+
+	differences := cfg.Diff(other)
+	keys := make([]string, len(differences))
+	for i, difference := range differences {
+		keys[i] = difference.Key
+	}
+	expectedKeys := []string{"added", "changed", "provenance", "removed"}
+	if !reflect.DeepEqual(keys, expectedKeys) {
+		t.Fatalf("Expected %+q but got %+q", expectedKeys, keys)
+	}
+	if differences[0].Before != nil || differences[0].After.Value != "value" {
+		t.Errorf("Expected added to only have an after entry but got %+v", differences[0])
+	}
+	if differences[1].Before.Value != "before" || differences[1].After.Value != "after" {
+		t.Errorf("Expected changed to go from before to after but got %+v", differences[1])
+	}
+	if differences[2].After.Provenance != Temporary {
+		t.Errorf("Expected provenance to become temporary but got %+v", differences[2])
+	}
+	if differences[3].Before.Value != "value" || differences[3].After != nil {
+		t.Errorf("Expected removed to only have a before entry but got %+v", differences[3])
+	}
+}
+
+func TestDump(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("name", "pake")
+	cfg.SetTemporarily("verbose", "true")
+
+	var buf bytes.Buffer
+	if err := cfg.Dump(&buf); err != nil {
+		t.Error(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		`name     "pake"  (permanent)`,
+		`verbose  "true"  (temporary, 1 left)`,
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, lines)
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	cfg := New()
+	cfg.SetTemporarily("verbose", "true")
+	cfg.SetFor("dryrun", "true", 0)
+	cfg.SetPermanently("name", "pake")
+
+	var buf bytes.Buffer
+	if err := cfg.DumpJSON(&buf); err != nil {
+		t.Error(err)
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]interface{}{
+		{
+			"key":        "dryrun",
+			"value":      "true",
+			"provenance": "temporary",
+			"remaining":  float64(0),
+			"scope":      float64(0),
+		},
+		{
+			"key":        "name",
+			"value":      "pake",
+			"provenance": "permanent",
+			"remaining":  float64(0),
+			"scope":      float64(0),
+		},
+		{
+			"key":        "verbose",
+			"value":      "true",
+			"provenance": "temporary",
+			"remaining":  float64(1),
+			"scope":      float64(0),
+		},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, entries)
+	}
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Sources describes where the initial values of a Config are loaded from by LoadSources.
+// Every value is set permanently, and sources are applied in the following order, with
+// later sources overriding earlier ones:
+//
+//  1. JSONFiles, in the order given
+//  2. KeyValueFiles, in the order given
+//  3. StateFile
+//  4. environment variables starting with EnvPrefix
+//
+// Values set by a script always override the loaded values, and declared defaults only
+// apply to keys that none of the sources set.
+type Sources struct {
+	// JSONFiles represents the JSON files to be loaded with LoadJSON().
+	JSONFiles []string
+	// KeyValueFiles represents the key=value files to be loaded with LoadKeyValue().
+	KeyValueFiles []string
+	// StateFile represents the state file written by SaveStateFile() in a previous run.
+	// It is skipped if it is empty or does not exist.
+	StateFile string
+	// EnvPrefix represents the prefix of the environment variables to be loaded with
+	// LoadEnv().  The environment is skipped if it is empty.
+	EnvPrefix string
+}
+
+// LoadSources loads the values of every source in the order described by Sources.  It
+// returns the first error encountered.
+func (c *Config) LoadSources(sources Sources) error {
+	for _, filename := range sources.JSONFiles {
+		if err := c.loadFile(filename, c.LoadJSON); err != nil {
+			return err
+		}
+	}
+	for _, filename := range sources.KeyValueFiles {
+		if err := c.loadFile(filename, c.LoadKeyValue); err != nil {
+			return err
+		}
+	}
+	if sources.StateFile != "" {
+		if err := c.LoadStateFile(sources.StateFile); err != nil {
+			return err
+		}
+	}
+	if sources.EnvPrefix != "" {
+		return c.LoadEnv(sources.EnvPrefix)
+	}
+	return nil
+}
+
+// loadFile opens the given file and loads it with the given function, naming the file in
+// any error returned.
+func (c *Config) loadFile(filename string, load func(io.Reader) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := load(f); err != nil {
+		return fmt.Errorf("Can't load %s: %s", filename, err.Error())
+	}
+	return nil
+}
+
+// LoadJSON reads a JSON object from the given reader and sets each of its members
+// permanently.  Members may be strings, numbers, bools or lists of strings; lists are
+// stored comma separated like SetStringSlicePermanently().  Nested objects are stored
+// under namespaced keys, so {"git": {"verbose": true}} sets git.verbose.
+func (c *Config) LoadJSON(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var values map[string]interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return err
+	}
+	return c.loadJSONObject("", values)
+}
+
+// loadJSONObject sets each member of the given JSON object permanently, prefixing the keys
+// with the given namespace.
+func (c *Config) loadJSONObject(namespace string, values map[string]interface{}) error {
+	for name, raw := range values {
+		key := namespace + name
+		if object, ok := raw.(map[string]interface{}); ok {
+			if err := c.loadJSONObject(key+namespaceSeparator, object); err != nil {
+				return err
+			}
+			continue
+		}
+		value, err := jsonValueToString(raw)
+		if err != nil {
+			return fmt.Errorf("Can't load %s: %s", key, err.Error())
+		}
+		if err := c.SetPermanently(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonValueToString converts a decoded JSON value into the string stored in a Config.
+func jsonValueToString(raw interface{}) (string, error) {
+	switch value := raw.(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case json.Number:
+		return value.String(), nil
+	case []interface{}:
+		elems := make([]string, len(value))
+		for i, elem := range value {
+			s, ok := elem.(string)
+			if !ok {
+				return "", fmt.Errorf("expected a list of strings")
+			}
+			elems[i] = s
+		}
+		return strings.Join(elems, stringSliceSeparator), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", raw)
+}
+
+// LoadKeyValue reads lines of the form `key = value` from the given reader and sets each
+// key permanently.  Blank lines and lines starting with # are skipped, whitespace around
+// keys and values is removed, and values may be surrounded by double quotes.
+func (c *Config) LoadKeyValue(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	linenum := 0
+	for scanner.Scan() {
+		linenum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("Expected key = value on line %d", linenum)
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if unquoted, err := strconv.Unquote(value); err == nil && strings.HasPrefix(value, `"`) {
+			value = unquoted
+		}
+		if err := c.SetPermanently(key, value); err != nil {
+			return fmt.Errorf("An error occured on line %d: %s", linenum, err.Error())
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadEnv sets every environment variable starting with the given prefix permanently.  The
+// key is the rest of the variable's name in lower case, so PAKE_VERBOSE=true with the prefix
+// PAKE_ sets verbose to true.  A double underscore separates namespaces, so
+// PAKE_GIT__VERBOSE sets git.verbose.
+func (c *Config) LoadEnv(prefix string) error {
+	return c.loadEnviron(prefix, os.Environ())
+}
+
+// loadEnviron is the same as LoadEnv but reads the variables from the given list of
+// key=value pairs.
+func (c *Config) loadEnviron(prefix string, environ []string) error {
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(parts[0], prefix))
+		key = strings.ReplaceAll(key, "__", namespaceSeparator)
+		if key == "" {
+			continue
+		}
+		if err := c.SetPermanently(key, parts[1]); err != nil {
+			return fmt.Errorf("Can't load %s: %s", parts[0], err.Error())
+		}
+	}
+	return nil
+}
+
+// Save writes the permanent values of the outermost scope to the given writer as a JSON
+// object that can be read back with Load().  Temporary values are not saved, but the
+// permanent values they override are.
+func (c *Config) Save(w io.Writer) error {
+	c.mu.RLock()
+	values := c.permanentValues()
+	c.mu.RUnlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(values)
+}
+
+// permanentValues returns the permanent values of the outermost scope.  The caller must hold
+// the lock.
+func (c *Config) permanentValues() map[string]string {
+	current, old, temporaries := c.current, c.old, c.temporaries
+	if len(c.scopes) != 0 {
+		outermost := c.scopes[0]
+		current, old, temporaries = outermost.current, outermost.old, outermost.temporaries
+	}
+	values := make(map[string]string)
+	for key, value := range current {
+		if _, ok := temporaries[key]; !ok {
+			values[key] = value
+		}
+	}
+	return copyStrings(values, old)
+}
+
+// Load reads values written by Save() from the given reader and sets them permanently.
+func (c *Config) Load(r io.Reader) error {
+	return c.LoadJSON(r)
+}
+
+// SaveStateFile writes the permanent values of the Config to the given file with Save(),
+// creating or truncating the file.
+func (c *Config) SaveStateFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := c.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadStateFile reads the values written by SaveStateFile() from the given file.  A file
+// that does not exist is treated as an empty state, as it is on the first run.
+func (c *Config) LoadStateFile(filename string) error {
+	err := c.loadFile(filename, c.Load)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
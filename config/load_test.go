@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadJSON_noerror(t *testing.T) {
+	cfg := New()
+
+	err := cfg.LoadJSON(strings.NewReader(
+		`{"name": "pake", "verbose": true, "retries": 3, "targets": ["a", "b"]}`))
+	if err != nil {
+		t.Error(err)
+	}
+	expectedCurrent := map[string]string{
+		"name":    "pake",
+		"verbose": "true",
+		"retries": "3",
+		"targets": "a,b",
+	}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestLoadJSON_nestedobject(t *testing.T) {
+	cfg := New()
+
+	err := cfg.LoadJSON(strings.NewReader(`{"git": {"verbose": true, "remote": {"name": "origin"}}}`))
+	if err != nil {
+		t.Error(err)
+	}
+	expectedCurrent := map[string]string{
+		"git.verbose":     "true",
+		"git.remote.name": "origin",
+	}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestLoadJSON_witherror(t *testing.T) {
+	cfg := New()
+
+	if err := cfg.LoadJSON(strings.NewReader(`{"key": null}`)); err == nil {
+		t.Error("Should not be able to load a null value")
+	}
+	if err := cfg.LoadJSON(strings.NewReader(`["key"]`)); err == nil {
+		t.Error("Should not be able to load a JSON array")
+	}
+}
+
+func TestLoadKeyValue_noerror(t *testing.T) {
+	cfg := New()
+
+	err := cfg.LoadKeyValue(strings.NewReader(
+		"# comment\n\nname = pake\n  greeting = \"hello world\"  \nempty =\n"))
+	if err != nil {
+		t.Error(err)
+	}
+	expectedCurrent := map[string]string{
+		"name":     "pake",
+		"greeting": "hello world",
+		"empty":    "",
+	}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestLoadKeyValue_witherror(t *testing.T) {
+	cfg := New()
+
+	err := cfg.LoadKeyValue(strings.NewReader("name = pake\nnot a pair\n"))
+	if err == nil {
+		t.Fatal("Should not be able to load a line without =")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected the error to name line 2 but got %s", err.Error())
+	}
+}
+
+func TestLoadKeyValue_undeclaredkey(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "verbose", Type: Bool})
+
+	if err := cfg.LoadKeyValue(strings.NewReader("verbose = yes\n")); err == nil {
+		t.Error("Should not be able to load an ill-typed value")
+	}
+	if err := cfg.LoadKeyValue(strings.NewReader("quiet = true\n")); err == nil {
+		t.Error("Should not be able to load an undeclared key")
+	}
+}
+
+func TestLoadEnviron(t *testing.T) {
+	cfg := New()
+
+	err := cfg.loadEnviron("PAKE_", []string{
+		"PAKE_VERBOSE=true",
+		"PAKE_OUTPUT_DIR=out=put",
+		"PAKE_GIT__VERBOSE=false",
+		"PAKE_=ignored",
+		"HOME=/root",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	expectedCurrent := map[string]string{
+		"verbose":     "true",
+		"output_dir":  "out=put",
+		"git.verbose": "false",
+	}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestSave_permanentonly(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("permanent", "value")
+	cfg.SetPermanently("overridden", "permanent")
+	cfg.SetTemporarily("overridden", "temporary")
+	cfg.SetTemporarily("temporary", "value")
+	cfg.PushScope()
+	cfg.SetPermanently("scoped", "value")
+
+	var buf bytes.Buffer
+	if err := cfg.Save(&buf); err != nil {
+		t.Error(err)
+	}
+	loaded := New()
+	if err := loaded.Load(&buf); err != nil {
+		t.Error(err)
+	}
+	expectedCurrent := map[string]string{
+		"permanent":  "value",
+		"overridden": "permanent",
+	}
+	if !reflect.DeepEqual(loaded.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, loaded.current)
+	}
+}
+
+func TestLoadStateFile_nonexistentfile(t *testing.T) {
+	cfg := New()
+
+	if err := cfg.LoadStateFile(filepath.Join(t.TempDir(), "state.json")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadSources_precedence(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "config.json")
+	kvFile := filepath.Join(dir, "config")
+	stateFile := filepath.Join(dir, "state.json")
+	ioutil.WriteFile(jsonFile, []byte(`{"a": "json", "b": "json", "c": "json", "d": "json"}`), 0644)
+	ioutil.WriteFile(kvFile, []byte("b = kv\nc = kv\nd = kv\n"), 0644)
+	state := New()
+	state.SetPermanently("c", "state")
+	state.SetPermanently("d", "state")
+	if err := state.SaveStateFile(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := New()
+	cfg.Declare(Flag{Name: "a", Type: String})
+	cfg.Declare(Flag{Name: "b", Type: String})
+	cfg.Declare(Flag{Name: "c", Type: String})
+	cfg.Declare(Flag{Name: "d", Type: String})
+	cfg.Declare(Flag{Name: "e", Type: String, Default: "default"})
+	err := cfg.LoadSources(Sources{
+		JSONFiles:     []string{jsonFile},
+		KeyValueFiles: []string{kvFile},
+		StateFile:     stateFile,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if err := cfg.loadEnviron("PAKE_", []string{"PAKE_D=env"}); err != nil {
+		t.Error(err)
+	}
+	expected := map[string]string{
+		"a": "json",
+		"b": "kv",
+		"c": "state",
+		"d": "env",
+		"e": "default",
+	}
+	for key, expectedValue := range expected {
+		value, err := cfg.Get(key)
+		if err != nil {
+			t.Error(err)
+		}
+		if value != expectedValue {
+			t.Errorf("Expected %s for %s but got %s", expectedValue, key, value)
+		}
+	}
+}
+
+func TestLoadSources_nonexistentfile(t *testing.T) {
+	cfg := New()
+
+	err := cfg.LoadSources(Sources{JSONFiles: []string{filepath.Join(t.TempDir(), "none.json")}})
+	if err == nil {
+		t.Error("Should not be able to load a config file that does not exist")
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// namespaceSeparator separates the namespaces of a key, as in "git.verbose".
+const namespaceSeparator = "."
+
+// fallbackKeys returns the given key followed by the keys it falls back to, from the
+// innermost namespace to the outermost one.  For example, "a.b.c" falls back to "a.c"
+// and then to "c".
+func fallbackKeys(key string) []string {
+	keys := []string{key}
+	i := strings.LastIndex(key, namespaceSeparator)
+	if i < 0 {
+		return keys
+	}
+	namespace, name := key[:i], key[i+1:]
+	for namespace != "" {
+		j := strings.LastIndex(namespace, namespaceSeparator)
+		if j < 0 {
+			namespace = ""
+			keys = append(keys, name)
+		} else {
+			namespace = namespace[:j]
+			keys = append(keys, namespace+namespaceSeparator+name)
+		}
+	}
+	return keys
+}
+
+// lookup retrieves the value of the given key using value to find the values that have been
+// set.  Values set for the key or any key it falls back to take precedence over the defaults
+// of the declared flags.
+func lookup(key string, value func(string) (string, bool), flags map[string]Flag) (string, bool) {
+	candidates := fallbackKeys(key)
+	for _, candidate := range candidates {
+		if val, ok := value(candidate); ok {
+			return val, true
+		}
+	}
+	for _, candidate := range candidates {
+		if flag, ok := flags[candidate]; ok && flag.Default != "" {
+			return flag.Default, true
+		}
+	}
+	return "", false
+}
+
+// KeysWithPrefix returns the sorted list of keys starting with the given prefix that have a
+// value, either because they have been set in any scope or because they are declared flags
+// with a default.
+func (c *Config) KeysWithPrefix(prefix string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	seen := make(map[string]bool)
+	add := func(key string) {
+		if strings.HasPrefix(key, prefix) {
+			seen[key] = true
+		}
+	}
+	for key := range c.current {
+		add(key)
+	}
+	for _, s := range c.scopes {
+		for key := range s.current {
+			add(key)
+		}
+	}
+	for name, flag := range c.flags {
+		if flag.Default != "" {
+			add(name)
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// A Namespace is a view of a Config that reads and writes keys under a prefix, so that
+// command families in a language can use the same names without colliding.  Reading a key
+// that has not been set in the namespace falls back to the enclosing namespaces.
+type Namespace struct {
+	config *Config
+	prefix string
+}
+
+// Sub returns a view of the Config that reads and writes keys under the given namespace, so
+// Sub("git").Get("verbose") reads "git.verbose" and falls back to "verbose".
+func (c *Config) Sub(namespace string) *Namespace {
+	return &Namespace{config: c, prefix: namespace + namespaceSeparator}
+}
+
+// Sub returns a view of the nested namespace, so Sub("git").Sub("remote") reads and writes
+// keys under "git.remote".
+func (n *Namespace) Sub(namespace string) *Namespace {
+	return &Namespace{config: n.config, prefix: n.prefix + namespace + namespaceSeparator}
+}
+
+// Key returns the key the given name is stored under in the Config.
+func (n *Namespace) Key(name string) string {
+	return n.prefix + name
+}
+
+// Get is the same as Config.Get for the key under the namespace.
+func (n *Namespace) Get(name string) (string, error) {
+	return n.config.Get(n.Key(name))
+}
+
+// GetBool is the same as Config.GetBool for the key under the namespace.
+func (n *Namespace) GetBool(name string, defaultValue bool) (bool, error) {
+	return n.config.GetBool(n.Key(name), defaultValue)
+}
+
+// GetInt is the same as Config.GetInt for the key under the namespace.
+func (n *Namespace) GetInt(name string, defaultValue int) (int, error) {
+	return n.config.GetInt(n.Key(name), defaultValue)
+}
+
+// GetDuration is the same as Config.GetDuration for the key under the namespace.
+func (n *Namespace) GetDuration(name string, defaultValue time.Duration) (time.Duration, error) {
+	return n.config.GetDuration(n.Key(name), defaultValue)
+}
+
+// GetStringSlice is the same as Config.GetStringSlice for the key under the namespace.
+func (n *Namespace) GetStringSlice(name string, defaultValue []string) ([]string, error) {
+	return n.config.GetStringSlice(n.Key(name), defaultValue)
+}
+
+// SetTemporarily is the same as Config.SetTemporarily for the key under the namespace.
+func (n *Namespace) SetTemporarily(name, value string) error {
+	return n.config.SetTemporarily(n.Key(name), value)
+}
+
+// SetFor is the same as Config.SetFor for the key under the namespace.
+func (n *Namespace) SetFor(name, value string, commands int) error {
+	return n.config.SetFor(n.Key(name), value, commands)
+}
+
+// SetPermanently is the same as Config.SetPermanently for the key under the namespace.
+func (n *Namespace) SetPermanently(name, value string) error {
+	return n.config.SetPermanently(n.Key(name), value)
+}
+
+// Keys returns the sorted list of names that have a value under the namespace, with the
+// namespace's prefix removed.
+func (n *Namespace) Keys() []string {
+	keys := n.config.KeysWithPrefix(n.prefix)
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, n.prefix)
+	}
+	return keys
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFallbackKeys(t *testing.T) {
+	tests := map[string][]string{
+		"verbose":       {"verbose"},
+		"git.verbose":   {"git.verbose", "verbose"},
+		"a.b.c":         {"a.b.c", "a.c", "c"},
+		"git.remote.fx": {"git.remote.fx", "git.fx", "fx"},
+	}
+	for key, expected := range tests {
+		if keys := fallbackKeys(key); !reflect.DeepEqual(keys, expected) {
+			t.Errorf("Expected %+q for %s but got %+q", expected, key, keys)
+		}
+	}
+}
+
+func TestGet_namespacefallback(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("verbose", "false")
+
+	value, err := cfg.Get("git.verbose")
+	if err != nil {
+		t.Error(err)
+	}
+	if value != "false" {
+		t.Errorf("Expected false but got %s", value)
+	}
+
+	cfg.SetPermanently("git.verbose", "true")
+	value, _ = cfg.Get("git.verbose")
+	if value != "true" {
+		t.Errorf("Expected true but got %s", value)
+	}
+	value, _ = cfg.Get("verbose")
+	if value != "false" {
+		t.Errorf("Expected false but got %s", value)
+	}
+}
+
+func TestGet_namespacesetvaluebeatsdefault(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "verbose", Type: Bool})
+	cfg.Declare(Flag{Name: "git.verbose", Type: Bool, Default: "false"})
+	cfg.SetPermanently("verbose", "true")
+
+	value, _ := cfg.Get("git.verbose")
+	if value != "true" {
+		t.Errorf("Expected true but got %s", value)
+	}
+}
+
+func TestSet_namespacedeclaredbyfallback(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "verbose", Type: Bool})
+
+	if err := cfg.SetPermanently("git.verbose", "true"); err != nil {
+		t.Error(err)
+	}
+	if err := cfg.SetPermanently("git.verbose", "loud"); err == nil {
+		t.Error("Should not be able to set git.verbose to `loud`")
+	}
+	if err := cfg.SetPermanently("git.color", "red"); err == nil {
+		t.Error("Should not be able to set an undeclared namespaced key")
+	}
+}
+
+func TestSub(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("verbose", "false")
+	git := cfg.Sub("git")
+
+	verbose, err := git.GetBool("verbose", true)
+	if err != nil {
+		t.Error(err)
+	}
+	if verbose != false {
+		t.Errorf("Expected false but got %t", verbose)
+	}
+
+	git.SetPermanently("verbose", "true")
+	git.Sub("remote").SetTemporarily("name", "origin")
+	value, _ := cfg.Get("git.verbose")
+	if value != "true" {
+		t.Errorf("Expected true but got %s", value)
+	}
+	value, _ = cfg.Get("git.remote.name")
+	if value != "origin" {
+		t.Errorf("Expected origin but got %s", value)
+	}
+	expectedKeys := []string{"remote.name", "verbose"}
+	if !reflect.DeepEqual(git.Keys(), expectedKeys) {
+		t.Errorf("Expected %+q but got %+q", expectedKeys, git.Keys())
+	}
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "git.color", Type: String, Default: "red"})
+	cfg.Declare(Flag{Name: "git.verbose", Type: Bool})
+	cfg.Declare(Flag{Name: "verbose", Type: Bool})
+	cfg.SetPermanently("verbose", "true")
+	cfg.PushScope()
+	cfg.SetTemporarily("git.verbose", "true")
+
+	expectedKeys := []string{"git.color", "git.verbose"}
+	if keys := cfg.KeysWithPrefix("git."); !reflect.DeepEqual(keys, expectedKeys) {
+		t.Errorf("Expected %+q but got %+q", expectedKeys, keys)
+	}
+	expectedKeys = []string{"git.color", "git.verbose", "verbose"}
+	if keys := cfg.KeysWithPrefix(""); !reflect.DeepEqual(keys, expectedKeys) {
+		t.Errorf("Expected %+q but got %+q", expectedKeys, keys)
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Cause represents why the value of a key changed.
+type Cause int
+
+const (
+	// CauseTemporary means the key was set by SetTemporarily() or SetFor().
+	CauseTemporary Cause = iota
+	// CausePermanent means the key was set by SetPermanently().
+	CausePermanent
+	// CauseExpiry means a temporary value of the key was cleared by SmartReset().
+	CauseExpiry
+	// CauseReset means a temporary value of the key was cleared by Reset().
+	CauseReset
+	// CauseRestore means the value of the key was replaced by SetState().
+	CauseRestore
+)
+
+// String returns a description of the cause.
+func (c Cause) String() string {
+	switch c {
+	case CauseTemporary:
+		return "temporary"
+	case CausePermanent:
+		return "permanent"
+	case CauseExpiry:
+		return "expiry"
+	case CauseReset:
+		return "reset"
+	case CauseRestore:
+		return "restore"
+	}
+	return fmt.Sprintf("Cause(%d)", int(c))
+}
+
+// A Change describes a change made to the value of a key.
+type Change struct {
+	// Key is the key whose value changed.
+	Key string
+	// Old is the value of the key before the change, or an empty string if it had none.
+	Old string
+	// New is the value of the key after the change, or an empty string if it has none.
+	New string
+	// Cause is the reason the value changed.
+	Cause Cause
+	// Source is the label given to SetSource() before the change was made, such as the
+	// position of the command that made it.
+	Source string
+	// Time is when the change was made.
+	Time time.Time
+}
+
+// Subscribe registers fn to be called with every change made to the Config from then on,
+// in the order the changes were made.  fn is called after the Config's lock is released,
+// so it may read from the Config.  Subscribers are not copied by Clone().  It returns a
+// function that unsubscribes fn.
+func (c *Config) Subscribe(fn func(Change)) (unsubscribe func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.observers == nil {
+		c.observers = make(map[int]func(Change))
+	}
+	id := c.nextObserverID
+	c.nextObserverID++
+	c.observers[id] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.observers, id)
+	}
+}
+
+// SetSource sets the label recorded with every following change, such as "line 3".  This
+// is meant to be called before a command is executed so that changes can be traced back to
+// the command that made them.
+func (c *Config) SetSource(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.source = source
+}
+
+// record queues a change to the given key made since its value was before, if there are any
+// observers.  The caller must hold the lock.
+func (c *Config) record(key, before string, cause Cause) {
+	if len(c.observers) == 0 {
+		return
+	}
+	after, _ := c.get(key)
+	c.pending = append(c.pending, Change{
+		Key:    key,
+		Old:    before,
+		New:    after,
+		Cause:  cause,
+		Source: c.source,
+		Time:   time.Now(),
+	})
+}
+
+// publish calls the observers with the queued changes.  The caller must not hold the lock.
+func (c *Config) publish() {
+	c.mu.Lock()
+	changes := c.pending
+	c.pending = nil
+	observers := make([]func(Change), 0, len(c.observers))
+	for id := 0; id < c.nextObserverID; id++ {
+		if fn, ok := c.observers[id]; ok {
+			observers = append(observers, fn)
+		}
+	}
+	c.mu.Unlock()
+	for _, change := range changes {
+		for _, fn := range observers {
+			fn(change)
+		}
+	}
+}
+
+// A History records the changes made to a Config so that it can report which command set a
+// key and when the value expired.  A History is safe for concurrent use by multiple
+// goroutines.
+type History struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+// NewHistory returns a History subscribed to the changes of the given Config.
+func NewHistory(c *Config) *History {
+	h := &History{}
+	c.Subscribe(h.Record)
+	return h
+}
+
+// Record adds the given change to the History.
+func (h *History) Record(change Change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.changes = append(h.changes, change)
+}
+
+// Changes returns the recorded changes of the given key in the order they were made, or
+// every recorded change if key is empty.
+func (h *History) Changes(key string) []Change {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var changes []Change
+	for _, change := range h.changes {
+		if key == "" || change.Key == key {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// WriteReport writes a line describing each recorded change of the given key to w.
+func (h *History) WriteReport(w io.Writer, key string) error {
+	for _, change := range h.Changes(key) {
+		source := change.Source
+		if source == "" {
+			source = "unknown source"
+		}
+		timestamp := change.Time.Format(time.RFC3339)
+		var err error
+		switch change.Cause {
+		case CauseTemporary:
+			_, err = fmt.Fprintf(w, "%s: %s set %s to %q temporarily (was %q)\n",
+				timestamp, source, change.Key, change.New, change.Old)
+		case CausePermanent:
+			_, err = fmt.Fprintf(w, "%s: %s set %s to %q permanently (was %q)\n",
+				timestamp, source, change.Key, change.New, change.Old)
+		case CauseRestore:
+			_, err = fmt.Fprintf(w, "%s: %s restored %s to %q (was %q)\n",
+				timestamp, source, change.Key, change.New, change.Old)
+		default:
+			_, err = fmt.Fprintf(w, "%s: %s %q ended by %s after %s, reverted to %q\n",
+				timestamp, change.Key, change.Old, change.Cause, source, change.New)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribe_causes(t *testing.T) {
+	cfg := New()
+	var changes []Change
+	cfg.Subscribe(func(change Change) {
+		change.Time = time.Time{}
+		changes = append(changes, change)
+	})
+
+	cfg.SetSource("line 1")
+	cfg.SetPermanently("key", "permanent")
+	cfg.SetSource("line 2")
+	cfg.SetTemporarily("key", "temporary")
+	cfg.SmartReset()
+	cfg.SetSource("line 3")
+	cfg.SmartReset()
+	cfg.SetTemporarily("other", "temporary")
+	cfg.Reset()
+
+	expected := []Change{
+		{Key: "key", Old: "", New: "permanent", Cause: CausePermanent, Source: "line 1"},
+		{Key: "key", Old: "permanent", New: "temporary", Cause: CauseTemporary, Source: "line 2"},
+		{Key: "key", Old: "temporary", New: "permanent", Cause: CauseExpiry, Source: "line 3"},
+		{Key: "other", Old: "", New: "temporary", Cause: CauseTemporary, Source: "line 3"},
+		{Key: "other", Old: "temporary", New: "", Cause: CauseReset, Source: "line 3"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, changes)
+	}
+}
+
+func TestSubscribe_unsubscribe(t *testing.T) {
+	cfg := New()
+	count := 0
+	unsubscribe := cfg.Subscribe(func(change Change) {
+		count++
+	})
+
+	cfg.SetPermanently("key", "value")
+	unsubscribe()
+	cfg.SetPermanently("key", "value2")
+
+	if count != 1 {
+		t.Errorf("Expected 1 change but got %d", count)
+	}
+}
+
+func TestSubscribe_readfromobserver(t *testing.T) {
+	cfg := New()
+	var seen string
+	cfg.Subscribe(func(change Change) {
+		seen, _ = cfg.Get(change.Key)
+	})
+
+	cfg.SetPermanently("key", "value")
+
+	if seen != "value" {
+		t.Errorf("Expected value but got %s", seen)
+	}
+}
+
+func TestSmartReset_noexpirychangeforshadowedvalue(t *testing.T) {
+	cfg := New()
+	cfg.SetFor("key", "long", 3)
+	cfg.SetFor("key", "short", 2)
+	var changes []Change
+	cfg.Subscribe(func(change Change) {
+		changes = append(changes, change)
+	})
+
+	cfg.SmartReset()
+	cfg.SmartReset()
+	cfg.SmartReset()
+
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change but got %+v", changes)
+	}
+	if changes[0].Old != "short" || changes[0].New != "long" || changes[0].Cause != CauseExpiry {
+		t.Errorf("Expected short to expire back to long but got %+v", changes[0])
+	}
+}
+
+func TestHistory(t *testing.T) {
+	cfg := New()
+	history := NewHistory(cfg)
+
+	cfg.SetSource("line 1")
+	cfg.SetTemporarily("verbose", "true")
+	cfg.SetPermanently("color", "red")
+	cfg.SmartReset()
+	cfg.SetSource("line 2")
+	cfg.SmartReset()
+
+	changes := history.Changes("verbose")
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes but got %+v", changes)
+	}
+	if changes[0].Source != "line 1" || changes[0].Cause != CauseTemporary {
+		t.Errorf("Expected verbose to be set temporarily by line 1 but got %+v", changes[0])
+	}
+	if changes[1].Source != "line 2" || changes[1].Cause != CauseExpiry {
+		t.Errorf("Expected verbose to expire after line 2 but got %+v", changes[1])
+	}
+	if len(history.Changes("")) != 3 {
+		t.Errorf("Expected 3 changes but got %+v", history.Changes(""))
+	}
+
+	var buf bytes.Buffer
+	if err := history.WriteReport(&buf, "verbose"); err != nil {
+		t.Error(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines but got %s", buf.String())
+	}
+	if !strings.Contains(lines[0], `line 1 set verbose to "true" temporarily`) {
+		t.Errorf("Unexpected report line %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `verbose "true" ended by expiry after line 2`) {
+		t.Errorf("Unexpected report line %s", lines[1])
+	}
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// FlagType represents the type of the values a declared flag accepts.
+type FlagType int
+
+const (
+	// String flags accept any value.
+	String FlagType = iota
+	// Bool flags accept any value accepted by strconv.ParseBool.
+	Bool
+	// Int flags accept any value accepted by strconv.Atoi.
+	Int
+	// Duration flags accept any value accepted by time.ParseDuration.
+	Duration
+	// StringSlice flags accept a list of comma separated strings.
+	StringSlice
+)
+
+// String returns the name of the flag type.
+func (t FlagType) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case Int:
+		return "int"
+	case Duration:
+		return "duration"
+	case StringSlice:
+		return "[]string"
+	}
+	return fmt.Sprintf("FlagType(%d)", int(t))
+}
+
+// validate checks to see if the given value can be parsed as the flag type.
+func (t FlagType) validate(value string) error {
+	var err error
+	switch t {
+	case String, StringSlice:
+	case Bool:
+		_, err = strconv.ParseBool(value)
+	case Int:
+		_, err = strconv.Atoi(value)
+	case Duration:
+		_, err = time.ParseDuration(value)
+	default:
+		err = fmt.Errorf("Unknown flag type %s", t)
+	}
+	return err
+}
+
+// A Flag describes a key that a language allows to be set in the Config.
+type Flag struct {
+	// Name is the key the flag is stored under.
+	Name string
+	// Type is the type of values the flag accepts.
+	Type FlagType
+	// Default is the value returned by Get when the flag has not been set.  An empty
+	// Default means the flag has no default value.
+	Default string
+	// Allowed is the list of values the flag accepts.  An empty list allows any value
+	// of the flag's type.
+	Allowed []string
+	// Description explains what the flag does and is used for help output.
+	Description string
+}
+
+// validate checks to see if the given value is valid for the flag and returns an error naming
+// the flag if it is not.
+func (f Flag) validate(value string) error {
+	if err := f.Type.validate(value); err != nil {
+		return fmt.Errorf("Can't use %q for %s: expected a value of type %s", value, f.Name, f.Type)
+	}
+	if len(f.Allowed) == 0 {
+		return nil
+	}
+	for _, allowed := range f.Allowed {
+		if value == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("Can't use %q for %s: expected one of %s", value, f.Name,
+		strings.Join(f.Allowed, ", "))
+}
+
+// Declare adds the given flag to the Config's schema.  Once a flag has been declared, setting
+// a key that has not been declared or setting a value that is not valid for the declared flag
+// is rejected, and Get returns the flag's default value when the flag has not been set.  It
+// returns an error if the flag has no name, has already been declared or has an invalid
+// default value.
+func (c *Config) Declare(flag Flag) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if flag.Name == "" {
+		return fmt.Errorf("Can't declare a flag without a name")
+	}
+	if _, ok := c.flags[flag.Name]; ok {
+		return fmt.Errorf("%s has already been declared", flag.Name)
+	}
+	if flag.Default != "" {
+		if err := flag.validate(flag.Default); err != nil {
+			return err
+		}
+	}
+	c.flags[flag.Name] = flag
+	return nil
+}
+
+// Flags returns the list of declared flags sorted by name.
+func (c *Config) Flags() []Flag {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	flags := make([]Flag, 0, len(c.flags))
+	for _, flag := range c.flags {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
+
+// PrintFlags writes a table of the declared flags, their types, defaults and descriptions to
+// the given writer for use in help output.
+func (c *Config) PrintFlags(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, flag := range c.Flags() {
+		fmt.Fprintf(tw, "%s\t%s\t", flag.Name, flag.Type)
+		if flag.Default != "" {
+			fmt.Fprintf(tw, "(default %q)", flag.Default)
+		}
+		fmt.Fprintf(tw, "\t%s", flag.Description)
+		if len(flag.Allowed) != 0 {
+			fmt.Fprintf(tw, " [%s]", strings.Join(flag.Allowed, ", "))
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// validate checks the given key and value against the declared flags.  A namespaced key
+// such as "git.verbose" may also be set if one of the keys it falls back to, "verbose" in
+// this case, has been declared.  Any key and value is valid if no flags have been declared.
+// The caller must hold the lock.
+func (c *Config) validate(key, value string) error {
+	if len(c.flags) == 0 {
+		return nil
+	}
+	for _, candidate := range fallbackKeys(key) {
+		if flag, ok := c.flags[candidate]; ok {
+			flag.Name = key
+			return flag.validate(value)
+		}
+	}
+	return fmt.Errorf("%s is not a declared flag", key)
+}
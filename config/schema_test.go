@@ -0,0 +1,159 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeclare_noerror(t *testing.T) {
+	cfg := New()
+
+	flag := Flag{Name: "verbose", Type: Bool, Default: "false", Description: "Print more"}
+	if err := cfg.Declare(flag); err != nil {
+		t.Error(err)
+	}
+	expectedFlags := []Flag{flag}
+	if !reflect.DeepEqual(cfg.Flags(), expectedFlags) {
+		t.Errorf("Expected %+v but got %+v", expectedFlags, cfg.Flags())
+	}
+}
+
+func TestDeclare_duplicateflag(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "verbose", Type: Bool})
+
+	if err := cfg.Declare(Flag{Name: "verbose", Type: String}); err == nil {
+		t.Error("Should not be able to declare the same flag twice")
+	}
+}
+
+func TestDeclare_invaliddefault(t *testing.T) {
+	cfg := New()
+
+	if err := cfg.Declare(Flag{Name: "retries", Type: Int, Default: "many"}); err == nil {
+		t.Error("Should not be able to declare a flag with an ill-typed default")
+	}
+	err := cfg.Declare(Flag{
+		Name:    "color",
+		Type:    String,
+		Default: "purple",
+		Allowed: []string{"red", "green"},
+	})
+	if err == nil {
+		t.Error("Should not be able to declare a flag with a default that is not allowed")
+	}
+}
+
+func TestGet_declareddefault(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "color", Type: String, Default: "red"})
+	cfg.Declare(Flag{Name: "shape", Type: String})
+
+	value, err := cfg.Get("color")
+	if err != nil {
+		t.Error(err)
+	}
+	if value != "red" {
+		t.Errorf("Expected red but got %s", value)
+	}
+	if _, err := cfg.Get("shape"); err == nil {
+		t.Error("Should not be able to retrieve a flag without a default that was not set")
+	}
+
+	cfg.SetPermanently("color", "blue")
+	value, err = cfg.Get("color")
+	if err != nil {
+		t.Error(err)
+	}
+	if value != "blue" {
+		t.Errorf("Expected blue but got %s", value)
+	}
+}
+
+func TestSet_undeclaredkey(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "verbose", Type: Bool})
+
+	if err := cfg.SetPermanently("quiet", "true"); err == nil {
+		t.Error("Should not be able to permanently set an undeclared key")
+	}
+	if err := cfg.SetTemporarily("quiet", "true"); err == nil {
+		t.Error("Should not be able to temporarily set an undeclared key")
+	}
+	expectedCurrent := make(map[string]string)
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestSet_illtypedvalue(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "verbose", Type: Bool})
+	cfg.Declare(Flag{Name: "color", Type: String, Allowed: []string{"red", "green"}})
+
+	if err := cfg.SetPermanently("verbose", "loud"); err == nil {
+		t.Error("Should not be able to set a bool flag to `loud`")
+	}
+	if err := cfg.SetTemporarily("color", "purple"); err == nil {
+		t.Error("Should not be able to set a flag to a value that is not allowed")
+	}
+	if err := cfg.SetBoolTemporarily("verbose", true); err != nil {
+		t.Error(err)
+	}
+	if err := cfg.SetPermanently("color", "green"); err != nil {
+		t.Error(err)
+	}
+	expectedCurrent := map[string]string{"verbose": "true", "color": "green"}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestSet_noschema(t *testing.T) {
+	cfg := New()
+
+	if err := cfg.SetPermanently("anything", "goes"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetInt_declareddefault(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "retries", Type: Int, Default: "3"})
+
+	value, err := cfg.GetInt("retries", 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if value != 3 {
+		t.Errorf("Expected 3 but got %d", value)
+	}
+}
+
+func TestPrintFlags(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "verbose", Type: Bool, Default: "false", Description: "Print more"})
+	cfg.Declare(Flag{
+		Name:        "color",
+		Type:        String,
+		Allowed:     []string{"red", "green"},
+		Description: "Output color",
+	})
+
+	var buf bytes.Buffer
+	if err := cfg.PrintFlags(&buf); err != nil {
+		t.Error(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines but got %d: %s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "color") || !strings.Contains(lines[0], "[red, green]") {
+		t.Errorf("Unexpected help line for color: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "verbose") || !strings.Contains(lines[1], `(default "false")`) {
+		t.Errorf("Unexpected help line for verbose: %s", lines[1])
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import "errors"
+
+// A scope holds the state of an enclosing scope while an inner scope is active.
+type scope struct {
+	current     map[string]string
+	old         map[string]string
+	temporaries map[string][]*temporary
+}
+
+// PushScope starts a new innermost scope.  Values set while the scope is active, whether
+// temporarily or permanently, only override the values of the enclosing scopes and are
+// discarded when the scope is popped.  SmartReset() and Reset() only affect the innermost
+// scope, so flags set temporarily in an enclosing scope keep their age until the scope is
+// popped.
+func (c *Config) PushScope() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scopes = append(c.scopes, &scope{
+		current:     c.current,
+		old:         c.old,
+		temporaries: c.temporaries,
+	})
+	c.current = make(map[string]string)
+	c.old = make(map[string]string)
+	c.temporaries = make(map[string][]*temporary)
+}
+
+// PopScope discards the innermost scope and restores the state of the enclosing scope.  It
+// returns an error if there is no scope to pop.
+func (c *Config) PopScope() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.scopes) == 0 {
+		return errors.New("There is no scope to pop")
+	}
+	last := len(c.scopes) - 1
+	enclosing := c.scopes[last]
+	c.scopes = c.scopes[:last]
+	c.current = enclosing.current
+	c.old = enclosing.old
+	c.temporaries = enclosing.temporaries
+	return nil
+}
+
+// Depth returns the number of scopes that have been pushed and not yet popped.
+func (c *Config) Depth() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.scopes)
+}
+
+// InScope calls fn inside a new scope which is popped once fn returns, even if fn panics.
+// This is meant to be used by block constructs and procedure calls so that the flags they
+// set are restored on exit.  It returns the error returned by fn.
+func (c *Config) InScope(fn func() error) error {
+	c.PushScope()
+	defer c.PopScope()
+	return fn()
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPushScope_lookupwalksoutward(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("outer", "value")
+	cfg.SetPermanently("shadowed", "outer")
+
+	cfg.PushScope()
+	cfg.SetPermanently("shadowed", "inner")
+	cfg.SetPermanently("inner", "value")
+
+	expected := map[string]string{
+		"outer":    "value",
+		"shadowed": "inner",
+		"inner":    "value",
+	}
+	for key, expectedValue := range expected {
+		value, err := cfg.Get(key)
+		if err != nil {
+			t.Error(err)
+		}
+		if value != expectedValue {
+			t.Errorf("Expected %s for %s but got %s", expectedValue, key, value)
+		}
+	}
+	if cfg.Depth() != 1 {
+		t.Errorf("Expected a depth of 1 but got %d", cfg.Depth())
+	}
+}
+
+func TestPopScope_restoresenclosingscope(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("key", "outer")
+
+	cfg.PushScope()
+	cfg.SetPermanently("key", "inner")
+	cfg.SetTemporarily("temp", "inner")
+	if err := cfg.PopScope(); err != nil {
+		t.Error(err)
+	}
+
+	expectedCurrent := map[string]string{"key": "outer"}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+	if _, err := cfg.Get("temp"); err == nil {
+		t.Error("Should not be able to retrieve a value set in a popped scope")
+	}
+	if cfg.Depth() != 0 {
+		t.Errorf("Expected a depth of 0 but got %d", cfg.Depth())
+	}
+}
+
+func TestPopScope_noscope(t *testing.T) {
+	cfg := New()
+
+	if err := cfg.PopScope(); err == nil {
+		t.Error("Should not be able to pop a scope that was never pushed")
+	}
+}
+
+func TestPushScope_nestedtemporary(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("key", "original")
+
+	cfg.PushScope()
+	cfg.SetTemporarily("key", "first")
+	cfg.PushScope()
+	cfg.SetTemporarily("key", "second")
+
+	cfg.SmartReset()
+	cfg.SmartReset()
+	value, _ := cfg.Get("key")
+	if value != "first" {
+		t.Errorf("Expected first but got %s", value)
+	}
+
+	cfg.PopScope()
+	value, _ = cfg.Get("key")
+	if value != "first" {
+		t.Errorf("Expected first but got %s", value)
+	}
+	cfg.SmartReset()
+	cfg.SmartReset()
+	value, _ = cfg.Get("key")
+	if value != "original" {
+		t.Errorf("Expected original but got %s", value)
+	}
+
+	cfg.PopScope()
+	value, _ = cfg.Get("key")
+	if value != "original" {
+		t.Errorf("Expected original but got %s", value)
+	}
+}
+
+func TestInScope(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("key", "outer")
+	expectedErr := errors.New("Error from block")
+
+	err := cfg.InScope(func() error {
+		cfg.SetPermanently("key", "inner")
+		value, _ := cfg.Get("key")
+		if value != "inner" {
+			t.Errorf("Expected inner but got %s", value)
+		}
+		return expectedErr
+	})
+	if err != expectedErr {
+		t.Errorf("Expected %v but got %v", expectedErr, err)
+	}
+	value, _ := cfg.Get("key")
+	if value != "outer" {
+		t.Errorf("Expected outer but got %s", value)
+	}
+	if cfg.Depth() != 0 {
+		t.Errorf("Expected a depth of 0 but got %d", cfg.Depth())
+	}
+}
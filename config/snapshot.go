@@ -0,0 +1,106 @@
+package config
+
+import "fmt"
+
+// A Snapshot is an immutable view of the values of a Config at the time Snapshot() was
+// called.  Later changes to the Config are not reflected in the Snapshot.  A Snapshot is
+// safe for concurrent use by multiple goroutines.
+type Snapshot struct {
+	// Entries represents the visible value of each key that has been set, with the values
+	// of inner scopes taking precedence over the values of enclosing scopes.
+	entries map[string]Entry
+	// Flags represents the declared flags, keyed by name.
+	flags map[string]Flag
+}
+
+// Snapshot returns an immutable view of the current values of the Config.
+func (c *Config) Snapshot() *Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := make(map[string]Entry)
+	for depth, s := range c.scopes {
+		addEntries(entries, s.current, s.temporaries, depth)
+	}
+	addEntries(entries, c.current, c.temporaries, len(c.scopes))
+	flags := make(map[string]Flag, len(c.flags))
+	for name, flag := range c.flags {
+		flags[name] = flag
+	}
+	return &Snapshot{entries: entries, flags: flags}
+}
+
+// addEntries adds an entry for every value of a scope at the given depth to entries,
+// replacing the entries of enclosing scopes.
+func addEntries(entries map[string]Entry, current map[string]string,
+	temporaries map[string][]*temporary, depth int) {
+	for key, value := range current {
+		entry := Entry{Key: key, Value: value, Provenance: Permanent, Scope: depth}
+		if stack, ok := temporaries[key]; ok {
+			mostRecent := stack[len(stack)-1]
+			entry.Provenance = Temporary
+			entry.Remaining = mostRecent.ttl - mostRecent.age
+		}
+		entries[key] = entry
+	}
+}
+
+// Get attempts to retrieve a value based on the given key.  It behaves like Config.Get
+// at the time the Snapshot was taken.
+func (s *Snapshot) Get(key string) (string, error) {
+	value := func(key string) (string, bool) {
+		entry, ok := s.entries[key]
+		return entry.Value, ok
+	}
+	if val, ok := lookup(key, value, s.flags); ok {
+		return val, nil
+	}
+	return "", fmt.Errorf("Can't find value for %s", key)
+}
+
+// Clone returns an independent copy of the Config, including its scopes, its temporary
+// values and their ages, and its declared flags.  Changes made to the copy do not affect
+// the original and vice versa.
+func (c *Config) Clone() *Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	clone := &Config{
+		current:           copyStrings(make(map[string]string), c.current),
+		old:               copyStrings(make(map[string]string), c.old),
+		temporaries:       copyTemporaries(c.temporaries),
+		setTemporarilyAge: c.setTemporarilyAge,
+		flags:             make(map[string]Flag, len(c.flags)),
+	}
+	for name, flag := range c.flags {
+		clone.flags[name] = flag
+	}
+	for _, s := range c.scopes {
+		clone.scopes = append(clone.scopes, &scope{
+			current:     copyStrings(make(map[string]string), s.current),
+			old:         copyStrings(make(map[string]string), s.old),
+			temporaries: copyTemporaries(s.temporaries),
+		})
+	}
+	return clone
+}
+
+// copyStrings copies every key and value of src into dst and returns dst.
+func copyStrings(dst, src map[string]string) map[string]string {
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dst
+}
+
+// copyTemporaries returns a deep copy of the given temporary values.
+func copyTemporaries(temporaries map[string][]*temporary) map[string][]*temporary {
+	temporariesCopy := make(map[string][]*temporary, len(temporaries))
+	for key, stack := range temporaries {
+		stackCopy := make([]*temporary, len(stack))
+		for i, temp := range stack {
+			tempCopy := *temp
+			stackCopy[i] = &tempCopy
+		}
+		temporariesCopy[key] = stackCopy
+	}
+	return temporariesCopy
+}
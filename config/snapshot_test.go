@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot_immutable(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("key", "value")
+	cfg.PushScope()
+	cfg.SetTemporarily("inner", "value")
+
+	snapshot := cfg.Snapshot()
+	cfg.SetPermanently("key", "changed")
+	cfg.PopScope()
+
+	value, err := snapshot.Get("key")
+	if err != nil {
+		t.Error(err)
+	}
+	if value != "value" {
+		t.Errorf("Expected value but got %s", value)
+	}
+	value, err = snapshot.Get("inner")
+	if err != nil {
+		t.Error(err)
+	}
+	if value != "value" {
+		t.Errorf("Expected value but got %s", value)
+	}
+	if _, err := snapshot.Get("nonExistentKey"); err == nil {
+		t.Error("Should not able to retrieve any value")
+	}
+}
+
+func TestSnapshot_declareddefault(t *testing.T) {
+	cfg := New()
+	cfg.Declare(Flag{Name: "color", Type: String, Default: "red"})
+
+	value, err := cfg.Snapshot().Get("color")
+	if err != nil {
+		t.Error(err)
+	}
+	if value != "red" {
+		t.Errorf("Expected red but got %s", value)
+	}
+}
+
+func TestClone_independent(t *testing.T) {
+	cfg := WithSetTemporarilyAge(2)
+	cfg.SetPermanently("key", "value")
+	cfg.SetTemporarily("key", "temporary")
+	cfg.SmartReset()
+
+	clone := cfg.Clone()
+	clone.SetPermanently("other", "value")
+	clone.SmartReset()
+	clone.SmartReset()
+
+	expectedCurrent := map[string]string{"key": "temporary"}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+	expectedSetTempAgeTracker := map[string]int{"key": 1}
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
+		t.Errorf("Expected %+q but got %+q", expectedSetTempAgeTracker, temporaryAges(cfg))
+	}
+	expectedCurrent = map[string]string{"key": "value", "other": "value"}
+	if !reflect.DeepEqual(clone.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, clone.current)
+	}
+}
+
+func TestClone_scopes(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("key", "outer")
+	cfg.PushScope()
+	cfg.SetPermanently("key", "inner")
+
+	clone := cfg.Clone()
+	clone.PopScope()
+
+	value, _ := cfg.Get("key")
+	if value != "inner" {
+		t.Errorf("Expected inner but got %s", value)
+	}
+	value, _ = clone.Get("key")
+	if value != "outer" {
+		t.Errorf("Expected outer but got %s", value)
+	}
+}
+
+func TestConfig_concurrentuse(t *testing.T) {
+	cfg := WithSetTemporarilyAge(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key%d", i%3)
+			for j := 0; j < 200; j++ {
+				cfg.SetTemporarily(key, fmt.Sprint(j))
+				cfg.SetPermanently("shared", fmt.Sprint(i))
+				cfg.Get(key)
+				cfg.SmartReset()
+				cfg.Snapshot().Get("shared")
+				cfg.Clone().SmartReset()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 3; i++ {
+		cfg.SmartReset()
+	}
+	expectedSetTempAgeTracker := make(map[string]int)
+	if !reflect.DeepEqual(temporaryAges(cfg), expectedSetTempAgeTracker) {
+		t.Errorf("Expected %+q but got %+q", expectedSetTempAgeTracker, temporaryAges(cfg))
+	}
+	expectedOld := make(map[string]string)
+	if !reflect.DeepEqual(cfg.old, expectedOld) {
+		t.Errorf("Expected %+q but got %+q", expectedOld, cfg.old)
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A State is the complete state of a Config, including the temporary values of every scope
+// and their ages, so that a Config can be restored exactly as it was, for example to resume
+// a script from a checkpoint.  Declared flags and observers are not part of the State.  A
+// State can be encoded as JSON.
+type State struct {
+	// Scopes holds the state of every scope, ordered from the outermost scope to the
+	// innermost one.
+	Scopes []ScopeState `json:"scopes"`
+	// SetTemporarilyAge is how many SmartReset() calls clear a value set by SetTemporarily().
+	SetTemporarilyAge int `json:"set_temporarily_age"`
+}
+
+// A ScopeState is the state of a single scope.
+type ScopeState struct {
+	// Values holds the current value of every key set in the scope.
+	Values map[string]string `json:"values"`
+	// Permanent holds the permanent value of every key whose value is currently overridden
+	// by a temporary value.
+	Permanent map[string]string `json:"permanent,omitempty"`
+	// Temporaries holds the stack of temporary values of every key, ordered from the oldest
+	// to the most recent.
+	Temporaries map[string][]TemporaryState `json:"temporaries,omitempty"`
+}
+
+// A TemporaryState is the state of a value set by SetTemporarily() or SetFor().
+type TemporaryState struct {
+	// Value is the temporary value of the key.
+	Value string `json:"value"`
+	// Age is how many SmartReset() calls were made since the value was set.
+	Age int `json:"age"`
+	// TTL is how many SmartReset() calls may be made before the value is cleared.
+	TTL int `json:"ttl"`
+}
+
+// State returns the complete state of the Config.
+func (c *Config) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	state := State{SetTemporarilyAge: c.setTemporarilyAge}
+	for _, s := range c.scopes {
+		state.Scopes = append(state.Scopes, scopeState(s.current, s.old, s.temporaries))
+	}
+	state.Scopes = append(state.Scopes, scopeState(c.current, c.old, c.temporaries))
+	return state
+}
+
+// scopeState returns the state of a scope.
+func scopeState(current, old map[string]string,
+	temporaries map[string][]*temporary) ScopeState {
+	state := ScopeState{
+		Values:      copyStrings(make(map[string]string), current),
+		Permanent:   copyStrings(make(map[string]string), old),
+		Temporaries: make(map[string][]TemporaryState, len(temporaries)),
+	}
+	for key, stack := range temporaries {
+		for _, temp := range stack {
+			state.Temporaries[key] = append(state.Temporaries[key],
+				TemporaryState{Value: temp.value, Age: temp.age, TTL: temp.ttl})
+		}
+	}
+	return state
+}
+
+// SetState replaces the state of the Config with the given State, which is usually returned
+// by State().  Observers are notified of every key whose value changed, with CauseRestore as
+// the cause.  It returns an error without changing the Config if the State has no scopes, has
+// a temporary value whose age or TTL is negative or has a temporary value for a key without a
+// value.
+func (c *Config) SetState(state State) error {
+	if len(state.Scopes) == 0 {
+		return fmt.Errorf("Can't use a state without any scopes")
+	}
+	var scopes []*scope
+	for _, s := range state.Scopes {
+		restored := &scope{
+			current:     copyStrings(make(map[string]string), s.Values),
+			old:         copyStrings(make(map[string]string), s.Permanent),
+			temporaries: make(map[string][]*temporary, len(s.Temporaries)),
+		}
+		for key, stack := range s.Temporaries {
+			if _, ok := s.Values[key]; !ok {
+				return fmt.Errorf("Can't use a temporary value for %s without a value", key)
+			}
+			for _, temp := range stack {
+				if temp.Age < 0 || temp.TTL < 0 {
+					return fmt.Errorf("Can't use a negative age or TTL for %s", key)
+				}
+				restored.temporaries[key] = append(restored.temporaries[key],
+					&temporary{value: temp.Value, age: temp.Age, ttl: temp.TTL})
+			}
+		}
+		scopes = append(scopes, restored)
+	}
+
+	defer c.publish()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	before := make(map[string]string)
+	for key := range c.setKeys() {
+		before[key], _ = c.get(key)
+	}
+	innermost := scopes[len(scopes)-1]
+	c.scopes = scopes[:len(scopes)-1]
+	c.current = innermost.current
+	c.old = innermost.old
+	c.temporaries = innermost.temporaries
+	if state.SetTemporarilyAge != 0 {
+		c.setTemporarilyAge = state.SetTemporarilyAge
+	}
+	changed := c.setKeys()
+	for key := range before {
+		changed[key] = true
+	}
+	keys := make([]string, 0, len(changed))
+	for key := range changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if after, _ := c.get(key); after != before[key] {
+			c.record(key, before[key], CauseRestore)
+		}
+	}
+	return nil
+}
+
+// setKeys returns every key that has a value in any scope.  The caller must hold the lock.
+func (c *Config) setKeys() map[string]bool {
+	keys := make(map[string]bool, len(c.current))
+	for key := range c.current {
+		keys[key] = true
+	}
+	for _, s := range c.scopes {
+		for key := range s.current {
+			keys[key] = true
+		}
+	}
+	return keys
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestState_roundtrip(t *testing.T) {
+	cfg := WithSetTemporarilyAge(2)
+	cfg.SetPermanently("color", "red")
+	cfg.SetFor("color", "blue", 3)
+	cfg.SmartReset()
+	cfg.PushScope()
+	cfg.SetTemporarily("verbose", "true")
+
+	encoded, err := json.Marshal(cfg.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state State
+	if err := json.Unmarshal(encoded, &state); err != nil {
+		t.Fatal(err)
+	}
+	restored := New()
+	if err := restored.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(restored.State(), cfg.State()) {
+		t.Errorf("Expected %+v but got %+v", cfg.State(), restored.State())
+	}
+	if !reflect.DeepEqual(restored.All(), cfg.All()) {
+		t.Errorf("Expected %+v but got %+v", cfg.All(), restored.All())
+	}
+	for i := 0; i < 3; i++ {
+		cfg.SmartReset()
+		restored.SmartReset()
+		if !reflect.DeepEqual(restored.All(), cfg.All()) {
+			t.Errorf("Expected %+v but got %+v", cfg.All(), restored.All())
+		}
+	}
+	restored.PopScope()
+	cfg.PopScope()
+	if !reflect.DeepEqual(restored.All(), cfg.All()) {
+		t.Errorf("Expected %+v but got %+v", cfg.All(), restored.All())
+	}
+}
+
+func TestSetState_invalid(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("color", "red")
+
+	for _, state := range []State{
+		{},
+		{Scopes: []ScopeState{{Temporaries: map[string][]TemporaryState{
+			"color": {{Value: "blue", TTL: 1}},
+		}}}},
+		{Scopes: []ScopeState{{
+			Values:      map[string]string{"color": "blue"},
+			Temporaries: map[string][]TemporaryState{"color": {{Value: "blue", Age: -1}}},
+		}}},
+	} {
+		if err := cfg.SetState(state); err == nil {
+			t.Errorf("Should not be able to set the state %+v", state)
+		}
+	}
+	expectedCurrent := map[string]string{"color": "red"}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestSetState_publishes(t *testing.T) {
+	cfg := New()
+	cfg.SetPermanently("color", "red")
+	cfg.SetPermanently("name", "pake")
+	state := cfg.State()
+	cfg.SetPermanently("color", "blue")
+	cfg.SetTemporarily("verbose", "true")
+	cfg.SetSource("resume")
+	var changes []Change
+	cfg.Subscribe(func(change Change) {
+		change.Time = time.Time{}
+		changes = append(changes, change)
+	})
+
+	if err := cfg.SetState(state); err != nil {
+		t.Fatal(err)
+	}
+	expectedChanges := []Change{
+		{Key: "color", Old: "blue", New: "red", Cause: CauseRestore, Source: "resume"},
+		{Key: "verbose", Old: "true", New: "", Cause: CauseRestore, Source: "resume"},
+	}
+	if !reflect.DeepEqual(changes, expectedChanges) {
+		t.Errorf("Expected %+v but got %+v", expectedChanges, changes)
+	}
+}
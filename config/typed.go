@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stringSliceSeparator separates the elements of a string slice stored in the Config.
+const stringSliceSeparator = ","
+
+// GetBool attempts to retrieve the value of the given key as a bool.  It returns defaultValue
+// if the key is not found and an error naming the key if the value is not a valid bool.
+func (c *Config) GetBool(key string, defaultValue bool) (bool, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return defaultValue, fmt.Errorf("Can't parse value %q for %s as a bool", val, key)
+	}
+	return b, nil
+}
+
+// GetInt attempts to retrieve the value of the given key as an int.  It returns defaultValue
+// if the key is not found and an error naming the key if the value is not a valid int.
+func (c *Config) GetInt(key string, defaultValue int) (int, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return defaultValue, fmt.Errorf("Can't parse value %q for %s as an int", val, key)
+	}
+	return i, nil
+}
+
+// GetDuration attempts to retrieve the value of the given key as a time.Duration.  The value
+// must be in a format accepted by time.ParseDuration such as "1m30s".  It returns defaultValue
+// if the key is not found and an error naming the key if the value is not a valid duration.
+func (c *Config) GetDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return defaultValue, fmt.Errorf("Can't parse value %q for %s as a duration", val, key)
+	}
+	return d, nil
+}
+
+// GetStringSlice attempts to retrieve the value of the given key as a list of comma separated
+// strings.  Whitespace surrounding each element is removed.  It returns defaultValue if the key
+// is not found.
+func (c *Config) GetStringSlice(key string, defaultValue []string) ([]string, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return defaultValue, nil
+	}
+	if strings.TrimSpace(val) == "" {
+		return []string{}, nil
+	}
+	elems := strings.Split(val, stringSliceSeparator)
+	for i, elem := range elems {
+		elems[i] = strings.TrimSpace(elem)
+	}
+	return elems, nil
+}
+
+// SetBoolTemporarily is the same as SetTemporarily but for bool values.
+func (c *Config) SetBoolTemporarily(key string, value bool) error {
+	return c.SetTemporarily(key, strconv.FormatBool(value))
+}
+
+// SetBoolPermanently is the same as SetPermanently but for bool values.
+func (c *Config) SetBoolPermanently(key string, value bool) error {
+	return c.SetPermanently(key, strconv.FormatBool(value))
+}
+
+// SetIntTemporarily is the same as SetTemporarily but for int values.
+func (c *Config) SetIntTemporarily(key string, value int) error {
+	return c.SetTemporarily(key, strconv.Itoa(value))
+}
+
+// SetIntPermanently is the same as SetPermanently but for int values.
+func (c *Config) SetIntPermanently(key string, value int) error {
+	return c.SetPermanently(key, strconv.Itoa(value))
+}
+
+// SetDurationTemporarily is the same as SetTemporarily but for time.Duration values.
+func (c *Config) SetDurationTemporarily(key string, value time.Duration) error {
+	return c.SetTemporarily(key, value.String())
+}
+
+// SetDurationPermanently is the same as SetPermanently but for time.Duration values.
+func (c *Config) SetDurationPermanently(key string, value time.Duration) error {
+	return c.SetPermanently(key, value.String())
+}
+
+// SetStringSliceTemporarily is the same as SetTemporarily but for a list of strings.  The
+// elements are stored comma separated, so they should not contain commas themselves.
+func (c *Config) SetStringSliceTemporarily(key string, value []string) error {
+	return c.SetTemporarily(key, strings.Join(value, stringSliceSeparator))
+}
+
+// SetStringSlicePermanently is the same as SetPermanently but for a list of strings.  The
+// elements are stored comma separated, so they should not contain commas themselves.
+func (c *Config) SetStringSlicePermanently(key string, value []string) error {
+	return c.SetPermanently(key, strings.Join(value, stringSliceSeparator))
+}
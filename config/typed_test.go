@@ -0,0 +1,203 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetBool_keyexists(t *testing.T) {
+	cfg := New()
+	cfg.current["key"] = "true"
+
+	value, err := cfg.GetBool("key", false)
+	if err != nil {
+		t.Error(err)
+	}
+	if value != true {
+		t.Errorf("Expected true but got %t", value)
+	}
+}
+
+func TestGetBool_nonexistentkey(t *testing.T) {
+	cfg := New()
+
+	value, err := cfg.GetBool("key", true)
+	if err != nil {
+		t.Error(err)
+	}
+	if value != true {
+		t.Errorf("Expected the default value true but got %t", value)
+	}
+}
+
+func TestGetBool_invalidvalue(t *testing.T) {
+	cfg := New()
+	cfg.current["key"] = "maybe"
+
+	value, err := cfg.GetBool("key", true)
+	if err == nil {
+		t.Fatal("Expected an error parsing `maybe` as a bool")
+	}
+	if !strings.Contains(err.Error(), "key") {
+		t.Errorf("Expected the error to name the key but got %s", err.Error())
+	}
+	if value != true {
+		t.Errorf("Expected the default value true but got %t", value)
+	}
+}
+
+func TestGetInt_keyexists(t *testing.T) {
+	cfg := New()
+	cfg.current["key"] = "42"
+
+	value, err := cfg.GetInt("key", 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if value != 42 {
+		t.Errorf("Expected 42 but got %d", value)
+	}
+}
+
+func TestGetInt_nonexistentkey(t *testing.T) {
+	cfg := New()
+
+	value, err := cfg.GetInt("key", 7)
+	if err != nil {
+		t.Error(err)
+	}
+	if value != 7 {
+		t.Errorf("Expected the default value 7 but got %d", value)
+	}
+}
+
+func TestGetInt_invalidvalue(t *testing.T) {
+	cfg := New()
+	cfg.current["key"] = "forty-two"
+
+	value, err := cfg.GetInt("key", 7)
+	if err == nil {
+		t.Fatal("Expected an error parsing `forty-two` as an int")
+	}
+	if !strings.Contains(err.Error(), "key") {
+		t.Errorf("Expected the error to name the key but got %s", err.Error())
+	}
+	if value != 7 {
+		t.Errorf("Expected the default value 7 but got %d", value)
+	}
+}
+
+func TestGetDuration_keyexists(t *testing.T) {
+	cfg := New()
+	cfg.current["key"] = "1m30s"
+
+	value, err := cfg.GetDuration("key", 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if value != 90*time.Second {
+		t.Errorf("Expected %s but got %s", 90*time.Second, value)
+	}
+}
+
+func TestGetDuration_invalidvalue(t *testing.T) {
+	cfg := New()
+	cfg.current["key"] = "soon"
+
+	value, err := cfg.GetDuration("key", time.Second)
+	if err == nil {
+		t.Fatal("Expected an error parsing `soon` as a duration")
+	}
+	if !strings.Contains(err.Error(), "key") {
+		t.Errorf("Expected the error to name the key but got %s", err.Error())
+	}
+	if value != time.Second {
+		t.Errorf("Expected the default value %s but got %s", time.Second, value)
+	}
+}
+
+func TestGetStringSlice_keyexists(t *testing.T) {
+	cfg := New()
+	cfg.current["key"] = "a, b,c"
+
+	value, err := cfg.GetStringSlice("key", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, value)
+	}
+}
+
+func TestGetStringSlice_emptyvalue(t *testing.T) {
+	cfg := New()
+	cfg.current["key"] = ""
+
+	value, err := cfg.GetStringSlice("key", []string{"default"})
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []string{}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, value)
+	}
+}
+
+func TestGetStringSlice_nonexistentkey(t *testing.T) {
+	cfg := New()
+
+	value, err := cfg.GetStringSlice("key", []string{"default"})
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []string{"default"}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, value)
+	}
+}
+
+func TestTypedSetters_permanently(t *testing.T) {
+	cfg := New()
+	cfg.SetBoolPermanently("bool", true)
+	cfg.SetIntPermanently("int", 3)
+	cfg.SetDurationPermanently("duration", 2*time.Second)
+	cfg.SetStringSlicePermanently("slice", []string{"a", "b"})
+
+	expectedCurrent := map[string]string{
+		"bool":     "true",
+		"int":      "3",
+		"duration": "2s",
+		"slice":    "a,b",
+	}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
+
+func TestTypedSetters_temporarily(t *testing.T) {
+	cfg := New()
+	cfg.SetBoolTemporarily("bool", true)
+	cfg.SetIntTemporarily("int", 3)
+	cfg.SetDurationTemporarily("duration", 2*time.Second)
+	cfg.SetStringSliceTemporarily("slice", []string{"a", "b"})
+
+	expectedCurrent := map[string]string{
+		"bool":     "true",
+		"int":      "3",
+		"duration": "2s",
+		"slice":    "a,b",
+	}
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+
+	cfg.SmartReset()
+	cfg.SmartReset()
+	expectedCurrent = make(map[string]string)
+	if !reflect.DeepEqual(cfg.current, expectedCurrent) {
+		t.Errorf("Expected %+q but got %+q", expectedCurrent, cfg.current)
+	}
+}
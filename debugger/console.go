@@ -0,0 +1,209 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// prompt is written before every command the Console reads.
+const prompt = "(pake) "
+
+// consoleHelp describes the commands understood by the Console.
+const consoleHelp = `break, b <file:line|line|command>  Add a breakpoint
+delete, d <id>                      Remove a breakpoint
+breakpoints                         List the breakpoints
+run, r, continue, c                 Run until a breakpoint is reached
+step, s                             Run until the next command
+next, n                             Run until the next command, stepping over blocks
+where, bt                           Show the blocks the script is paused in
+print, p [key]                      Show a key of the Config, or every key
+set <key> <value>                   Set a key of the Config permanently
+setfor <key> <value> <n>            Set a key of the Config for the paused command and the
+                                    n commands after it
+quit, q                             Stop the script without executing the remaining commands
+help, h                             Show this help
+`
+
+// A Console drives a Debugger with commands read one per line from a reader, writing what it
+// shows to a writer, so that a script can be debugged from a terminal.
+type Console struct {
+	// Represents the debugger the commands are given to.
+	debugger *Debugger
+	// Represents the reader the commands are read from.
+	scanner *bufio.Scanner
+	// Represents the writer everything the Console shows is written to.
+	w io.Writer
+	// Represents whether the script has been started.
+	started bool
+}
+
+// NewConsole returns a Console that reads commands for the given Debugger from the given
+// reader and writes to the given writer.
+func NewConsole(d *Debugger, r io.Reader, w io.Writer) *Console {
+	return &Console{debugger: d, scanner: bufio.NewScanner(r), w: w}
+}
+
+// Run reads and executes commands until the script has finished or the Console is told to
+// quit, starting the script with the given function the first time the Console is told to run
+// or step.  If the reader runs out of commands, the script is stopped without executing its
+// remaining commands.
+func (c *Console) Run(run func()) error {
+	for {
+		fmt.Fprint(c.w, prompt)
+		if !c.scanner.Scan() {
+			c.quit()
+			return c.scanner.Err()
+		}
+		fields := strings.Fields(c.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		finished, err := c.execute(fields[0], fields[1:], run)
+		if err != nil {
+			fmt.Fprintln(c.w, err.Error())
+		}
+		if finished {
+			return nil
+		}
+	}
+}
+
+// execute executes the given command with the given arguments.  It returns true once the
+// script has finished.
+func (c *Console) execute(command string, args []string, run func()) (bool, error) {
+	d := c.debugger
+	switch command {
+	case "break", "b":
+		b, err := d.SetBreakpoint(strings.Join(args, " "))
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(c.w, "Breakpoint %d at %s\n", b.ID, b)
+	case "delete", "d":
+		if len(args) != 1 {
+			return false, fmt.Errorf("Expected the ID of a breakpoint")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false, fmt.Errorf("Can't use %q as the ID of a breakpoint", args[0])
+		}
+		return false, d.ClearBreakpoint(id)
+	case "breakpoints":
+		for _, b := range d.Breakpoints() {
+			fmt.Fprintf(c.w, "%d\t%s\n", b.ID, b)
+		}
+	case "run", "r", "continue", "c":
+		return c.resume(run, d.Continue, false)
+	case "step", "s":
+		return c.resume(run, d.Step, true)
+	case "next", "n":
+		return c.resume(run, d.Next, true)
+	case "where", "bt":
+		stop, err := c.current()
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(c.w, "#0 %s\n", stop.Position)
+		for i := len(stop.Stack) - 1; i >= 0; i-- {
+			fmt.Fprintf(c.w, "#%d %s at %s\n", len(stop.Stack)-i, stop.Stack[i].Name,
+				stop.Stack[i].Position)
+		}
+	case "print", "p":
+		stop, err := c.current()
+		if err != nil {
+			return false, err
+		}
+		if len(args) == 0 {
+			return false, stop.Config.Dump(c.w)
+		}
+		value, err := stop.Config.Get(args[0])
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(c.w, "%s = %q\n", args[0], value)
+	case "set":
+		stop, err := c.current()
+		if err != nil {
+			return false, err
+		}
+		if len(args) != 2 {
+			return false, fmt.Errorf("Expected a key and a value")
+		}
+		return false, stop.Config.SetPermanently(args[0], args[1])
+	case "setfor":
+		stop, err := c.current()
+		if err != nil {
+			return false, err
+		}
+		if len(args) != 3 {
+			return false, fmt.Errorf("Expected a key, a value and a number of commands")
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil {
+			return false, fmt.Errorf("Can't use %q as a number of commands", args[2])
+		}
+		return false, stop.Config.SetFor(args[0], args[1], n)
+	case "quit", "q":
+		c.quit()
+		return true, nil
+	case "help", "h":
+		fmt.Fprint(c.w, consoleHelp)
+	default:
+		return false, fmt.Errorf("%s is not a valid command, try help", command)
+	}
+	return false, nil
+}
+
+// current returns where the script is paused or an error if it is not paused.
+func (c *Console) current() (Stop, error) {
+	stop, ok := c.debugger.Current()
+	if !ok {
+		return Stop{}, fmt.Errorf("The script is not paused")
+	}
+	return stop, nil
+}
+
+// resume starts the script with the given function if it has not been started, pausing before
+// its first command if stopOnEntry is true, or resumes it with the given function otherwise,
+// and waits for it to pause or finish.  It returns true once the script has finished.
+func (c *Console) resume(run func(), resume func() error, stopOnEntry bool) (bool, error) {
+	d := c.debugger
+	if !c.started {
+		if stopOnEntry {
+			d.StopOnEntry()
+		}
+		if err := d.Start(run); err != nil {
+			return false, err
+		}
+		c.started = true
+	} else if err := resume(); err != nil {
+		return false, err
+	}
+	stop, ok := d.Wait()
+	if !ok {
+		fmt.Fprintln(c.w, "The script has finished")
+		return true, nil
+	}
+	reason := stop.Reason
+	if stop.Reason == ReasonBreakpoint {
+		reason = fmt.Sprintf("breakpoint %d", stop.Breakpoint.ID)
+	}
+	fmt.Fprintf(c.w, "Paused at %s before %T: %s\n", stop.Position, stop.Command, reason)
+	return false, nil
+}
+
+// quit stops the script without executing its remaining commands and waits for it to finish.
+func (c *Console) quit() {
+	if !c.started {
+		return
+	}
+	c.debugger.Terminate()
+	for {
+		if _, ok := c.debugger.Wait(); !ok {
+			return
+		}
+	}
+}
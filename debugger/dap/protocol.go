@@ -0,0 +1,148 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// A request is a message sent by the client asking the server to do something.
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// A response is the message sent by the server once it has handled a request.
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+// An event is a message sent by the server to notify the client of a change.
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// readMessage reads the content of the next message from the given reader.  Every message is
+// preceded by a header holding its Content-Length and ending with an empty line.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("Can't use %q as the length of a message",
+			header.Get("Content-Length"))
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// writeMessage writes the given message as JSON to the given writer preceded by its header.
+func writeMessage(w io.Writer, message interface{}) error {
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// The arguments of the requests handled by the server and the bodies of its responses and
+// events.  Only the fields used by the server are declared.
+type (
+	source struct {
+		Name string `json:"name,omitempty"`
+		Path string `json:"path,omitempty"`
+	}
+
+	launchArguments struct {
+		Program     string            `json:"program"`
+		Targets     []string          `json:"targets"`
+		StopOnEntry bool              `json:"stopOnEntry"`
+		Config      map[string]string `json:"config"`
+	}
+
+	sourceBreakpoint struct {
+		Line int `json:"line"`
+	}
+
+	setBreakpointsArguments struct {
+		Source      source             `json:"source"`
+		Breakpoints []sourceBreakpoint `json:"breakpoints"`
+	}
+
+	functionBreakpoint struct {
+		Name string `json:"name"`
+	}
+
+	setFunctionBreakpointsArguments struct {
+		Breakpoints []functionBreakpoint `json:"breakpoints"`
+	}
+
+	breakpoint struct {
+		ID       int     `json:"id"`
+		Verified bool    `json:"verified"`
+		Message  string  `json:"message,omitempty"`
+		Line     int     `json:"line,omitempty"`
+		Source   *source `json:"source,omitempty"`
+	}
+
+	thread struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	stackFrame struct {
+		ID     int     `json:"id"`
+		Name   string  `json:"name"`
+		Source *source `json:"source,omitempty"`
+		Line   int     `json:"line"`
+		Column int     `json:"column"`
+	}
+
+	scope struct {
+		Name               string `json:"name"`
+		VariablesReference int    `json:"variablesReference"`
+		Expensive          bool   `json:"expensive"`
+	}
+
+	variable struct {
+		Name               string                    `json:"name"`
+		Value              string                    `json:"value"`
+		Type               string                    `json:"type,omitempty"`
+		PresentationHint   *variablePresentationHint `json:"presentationHint,omitempty"`
+		VariablesReference int                       `json:"variablesReference"`
+	}
+
+	variablePresentationHint struct {
+		Kind       string   `json:"kind,omitempty"`
+		Attributes []string `json:"attributes,omitempty"`
+	}
+
+	setVariableArguments struct {
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+	}
+)
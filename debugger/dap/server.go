@@ -0,0 +1,467 @@
+// Package dap provides a Debug Adapter Protocol server for scripts of any language built on
+// pake-lib, so that editors such as VS Code can launch a script, set breakpoints, step through
+// it and inspect and modify its Config.  The server communicates over a reader and a writer,
+// usually the standard input and output of the process.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+	"github.com/pake-go/pake-lib/debugger"
+	"github.com/pake-go/pake-lib/executor"
+	"github.com/pake-go/pake-lib/parser"
+	"github.com/pake-go/pake-lib/target"
+)
+
+// The only thread of a script and the only variables reference, which holds the Config.
+const (
+	threadID        = 1
+	configReference = 1
+)
+
+// A Server handles the requests of a single debugging session.
+type Server struct {
+	// Represents the parser scripts are parsed with.
+	parser *parser.Parser
+	// Represents the options given to the executor of a script.
+	options []executor.Option
+	// Represents the debugger of the script.
+	debugger *debugger.Debugger
+	// Represents the launched script, or nil if no script has been launched.
+	graph *target.Graph
+	// Represents the arguments the script was launched with.
+	launch launchArguments
+	// Represents the Config the script is executed with.
+	cfg *config.Config
+	// Represents the breakpoints of each source, keyed by absolute path.
+	breakpoints map[string][]breakpoint
+	// Represents the IDs of the breakpoints on command names.
+	functionBreakpoints []int
+	// Represents whether the script has been started.
+	started bool
+	// Closed once the script has finished and the events saying so have been sent.
+	finished chan struct{}
+	// Guards w, seq and failed.
+	mu sync.Mutex
+	// Represents the writer messages are written to.
+	w io.Writer
+	// Represents the sequence number of the last message written.
+	seq int
+	// Represents whether a command of the script returned an error.
+	failed bool
+}
+
+// New returns a Server that parses scripts with the given parser, allowing targets, and
+// executes them with an Executor given the options.
+func New(p *parser.Parser, opts ...executor.Option) *Server {
+	return &Server{
+		parser:      p,
+		options:     opts,
+		debugger:    debugger.New(),
+		breakpoints: make(map[string][]breakpoint),
+		finished:    make(chan struct{}),
+	}
+}
+
+// Serve reads requests from the given reader and writes responses and events to the given
+// writer until the client disconnects or the reader is closed, in which case the script is
+// stopped without executing its remaining commands.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	reader := bufio.NewReader(r)
+	for {
+		content, err := readMessage(reader)
+		if err == io.EOF {
+			s.stop()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		body, err := s.handle(&req)
+		if err != nil {
+			s.send(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command,
+				Message: err.Error()})
+			continue
+		}
+		s.send(&response{Type: "response", RequestSeq: req.Seq, Success: true,
+			Command: req.Command, Body: body})
+		// The script is only started or resumed once the response has been written, so that
+		// the client never sees a stopped event before the response.
+		switch req.Command {
+		case "initialize":
+			s.sendEvent("initialized", nil)
+		case "configurationDone":
+			s.start()
+		case "continue":
+			s.debugger.Continue()
+		case "next":
+			s.debugger.Next()
+		case "stepIn":
+			s.debugger.Step()
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+// handle handles the given request and returns the body of its response.
+func (s *Server) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsSetVariable":              true,
+			"supportsTerminateRequest":         true,
+			"supportTerminateDebuggee":         true,
+		}, nil
+	case "launch":
+		return nil, s.handleLaunch(req.Arguments)
+	case "setBreakpoints":
+		return s.handleSetBreakpoints(req.Arguments)
+	case "setFunctionBreakpoints":
+		return s.handleSetFunctionBreakpoints(req.Arguments)
+	case "configurationDone":
+		if s.graph == nil {
+			return nil, fmt.Errorf("No script has been launched")
+		}
+		if s.started {
+			return nil, fmt.Errorf("The script has already been started")
+		}
+		return nil, nil
+	case "threads":
+		return map[string][]thread{"threads": {{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		return s.handleStackTrace()
+	case "scopes":
+		return map[string][]scope{"scopes": {{Name: "Config",
+			VariablesReference: configReference}}}, nil
+	case "variables":
+		return s.handleVariables()
+	case "setVariable":
+		return s.handleSetVariable(req.Arguments)
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, s.paused()
+	case "next", "stepIn":
+		return nil, s.paused()
+	case "pause":
+		s.debugger.Pause()
+		return nil, nil
+	case "terminate", "disconnect":
+		s.stop()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s is not a supported request", req.Command)
+}
+
+// handleLaunch parses the script given in the arguments of a launch request and creates the
+// Config it is executed with, with the values given in the config argument set permanently.
+// Breakpoints set before the script was launched are verified again and a breakpoint event is
+// sent for each of them.
+func (s *Server) handleLaunch(arguments json.RawMessage) error {
+	if s.graph != nil {
+		return fmt.Errorf("A script has already been launched")
+	}
+	var args launchArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+	program, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	args.Program = program
+	graph, err := target.ParseFile(s.parser, program, log.New(io.Discard, "", 0))
+	if err != nil {
+		return err
+	}
+	if _, err := graph.Plan(args.Targets...); err != nil {
+		return err
+	}
+	cfg := config.New()
+	for key, value := range args.Config {
+		if err := cfg.SetPermanently(key, value); err != nil {
+			return err
+		}
+	}
+	if args.StopOnEntry {
+		s.debugger.StopOnEntry()
+	}
+	s.graph = graph
+	s.launch = args
+	s.cfg = cfg
+	for path, breakpoints := range s.breakpoints {
+		for i := range breakpoints {
+			s.verify(path, &breakpoints[i])
+			s.sendEvent("breakpoint", map[string]interface{}{"reason": "changed",
+				"breakpoint": breakpoints[i]})
+		}
+	}
+	return nil
+}
+
+// handleSetBreakpoints replaces the breakpoints of a source with the ones given in the
+// arguments of a setBreakpoints request.
+func (s *Server) handleSetBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range s.breakpoints[path] {
+		s.debugger.ClearBreakpoint(b.ID)
+	}
+	breakpoints := make([]breakpoint, 0, len(args.Breakpoints))
+	for _, requested := range args.Breakpoints {
+		added := s.debugger.AddBreakpoint(debugger.Breakpoint{
+			Position: pakelib.Position{File: path, Line: requested.Line},
+		})
+		b := breakpoint{ID: added.ID, Line: requested.Line, Source: &source{Path: path}}
+		s.verify(path, &b)
+		breakpoints = append(breakpoints, b)
+	}
+	s.breakpoints[path] = breakpoints
+	return map[string][]breakpoint{"breakpoints": breakpoints}, nil
+}
+
+// verify marks the given breakpoint of the given source as verified if the launched script
+// has a command on its line, or explains why it is not verified otherwise.
+func (s *Server) verify(path string, b *breakpoint) {
+	b.Verified = false
+	switch {
+	case s.graph == nil:
+		b.Message = "The script has not been launched yet"
+		return
+	case path != s.launch.Program:
+		b.Message = "The breakpoint is not in the launched script"
+		return
+	}
+	for _, pos := range s.graph.Positions() {
+		if pos.Line == b.Line {
+			b.Verified = true
+			b.Message = ""
+			return
+		}
+	}
+	b.Message = fmt.Sprintf("There is no command on line %d", b.Line)
+}
+
+// handleSetFunctionBreakpoints replaces the breakpoints on command names with the ones given
+// in the arguments of a setFunctionBreakpoints request.
+func (s *Server) handleSetFunctionBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args setFunctionBreakpointsArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	for _, id := range s.functionBreakpoints {
+		s.debugger.ClearBreakpoint(id)
+	}
+	s.functionBreakpoints = nil
+	breakpoints := make([]breakpoint, 0, len(args.Breakpoints))
+	for _, requested := range args.Breakpoints {
+		b := s.debugger.AddBreakpoint(debugger.Breakpoint{Command: requested.Name})
+		s.functionBreakpoints = append(s.functionBreakpoints, b.ID)
+		breakpoints = append(breakpoints, breakpoint{ID: b.ID, Verified: true})
+	}
+	return map[string][]breakpoint{"breakpoints": breakpoints}, nil
+}
+
+// paused returns an error if the script is not paused.
+func (s *Server) paused() error {
+	if _, ok := s.debugger.Current(); !ok {
+		return fmt.Errorf("The script is not paused")
+	}
+	return nil
+}
+
+// start starts the launched script and sends a stopped event every time it pauses, followed by
+// a terminated and an exited event once it has finished.
+func (s *Server) start() error {
+	opts := append([]executor.Option{
+		s.debugger.Option(),
+		executor.WithFilename(s.launch.Program),
+		executor.WithOnError(func(inv *executor.Invocation, err error) {
+			s.mu.Lock()
+			s.failed = true
+			s.mu.Unlock()
+			s.sendOutput("stderr", fmt.Sprintf("There was an error in %s at line %d: %s\n",
+				inv.Position.File, inv.Position.Line, err.Error()))
+		}),
+	}, s.options...)
+	e := executor.New(log.New(&outputWriter{s}, "", 0), opts...)
+	err := s.debugger.Start(func() {
+		s.graph.Run(e, s.cfg, s.launch.Targets...)
+	})
+	if err != nil {
+		return err
+	}
+	s.started = true
+	go func() {
+		defer close(s.finished)
+		for {
+			stop, ok := s.debugger.Wait()
+			if !ok {
+				break
+			}
+			s.sendEvent("stopped", map[string]interface{}{
+				"reason":            stop.Reason,
+				"threadId":          threadID,
+				"allThreadsStopped": true,
+			})
+		}
+		exitCode := 0
+		s.mu.Lock()
+		if s.failed {
+			exitCode = 1
+		}
+		s.mu.Unlock()
+		s.sendEvent("terminated", nil)
+		s.sendEvent("exited", map[string]int{"exitCode": exitCode})
+	}()
+	return nil
+}
+
+// stop stops the script without executing its remaining commands and waits for it to finish.
+func (s *Server) stop() {
+	if !s.started {
+		return
+	}
+	s.debugger.Terminate()
+	<-s.finished
+}
+
+// handleStackTrace returns the command the script is paused at followed by the blocks it is
+// executed in, innermost first.
+func (s *Server) handleStackTrace() (interface{}, error) {
+	if err := s.paused(); err != nil {
+		return nil, err
+	}
+	stop, _ := s.debugger.Current()
+	frames := []stackFrame{{
+		ID:     1,
+		Name:   fmt.Sprintf("%T", stop.Command),
+		Source: &source{Name: filepath.Base(stop.Position.File), Path: stop.Position.File},
+		Line:   stop.Position.Line,
+		Column: 1,
+	}}
+	for i := len(stop.Stack) - 1; i >= 0; i-- {
+		frame := stop.Stack[i]
+		frames = append(frames, stackFrame{
+			ID:     len(frames) + 1,
+			Name:   frame.Name,
+			Source: &source{Name: filepath.Base(frame.Position.File), Path: frame.Position.File},
+			Line:   frame.Position.Line,
+			Column: 1,
+		})
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// handleVariables returns every key of the Config of the paused script.
+func (s *Server) handleVariables() (interface{}, error) {
+	if err := s.paused(); err != nil {
+		return nil, err
+	}
+	stop, _ := s.debugger.Current()
+	return map[string][]variable{"variables": variablesOf(stop.Config)}, nil
+}
+
+// variablesOf returns a variable for every entry of the given Config.  The type of a variable
+// is the type of the declared flag of its key, if any, and its presentation hint describes
+// where its value comes from and, for temporary values, how many commands it lasts.
+func variablesOf(cfg *config.Config) []variable {
+	types := make(map[string]string)
+	for _, flag := range cfg.Flags() {
+		types[flag.Name] = flag.Type.String()
+	}
+	entries := cfg.All()
+	variables := make([]variable, 0, len(entries))
+	for _, entry := range entries {
+		hint := &variablePresentationHint{
+			Kind:       "property",
+			Attributes: []string{entry.Provenance.String()},
+		}
+		if entry.Provenance == config.Temporary {
+			hint.Attributes = append(hint.Attributes, fmt.Sprintf("%d left", entry.Remaining))
+		}
+		variables = append(variables, variable{
+			Name:             entry.Key,
+			Value:            entry.Value,
+			Type:             types[entry.Key],
+			PresentationHint: hint,
+		})
+	}
+	return variables
+}
+
+// handleSetVariable permanently sets a key of the Config of the paused script.
+func (s *Server) handleSetVariable(arguments json.RawMessage) (interface{}, error) {
+	var args setVariableArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	if err := s.paused(); err != nil {
+		return nil, err
+	}
+	stop, _ := s.debugger.Current()
+	if args.VariablesReference != configReference {
+		return nil, fmt.Errorf("There are no variables for reference %d",
+			args.VariablesReference)
+	}
+	if err := stop.Config.SetPermanently(args.Name, args.Value); err != nil {
+		return nil, err
+	}
+	return map[string]string{"value": args.Value}, nil
+}
+
+// send writes the given response with the next sequence number.
+func (s *Server) send(r *response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	r.Seq = s.seq
+	writeMessage(s.w, r)
+}
+
+// sendEvent writes an event with the given name and body with the next sequence number.
+func (s *Server) sendEvent(name string, body interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	writeMessage(s.w, &event{Seq: s.seq, Type: "event", Event: name, Body: body})
+}
+
+// sendOutput sends the given output of the script in the given category.
+func (s *Server) sendOutput(category, output string) {
+	s.sendEvent("output", map[string]string{"category": category, "output": output})
+}
+
+// An outputWriter sends everything written to it as the standard output of the script.
+type outputWriter struct {
+	server *Server
+}
+
+// Write sends the given bytes in an output event.
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.server.sendOutput("stdout", string(p))
+	return len(p), nil
+}
@@ -0,0 +1,324 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+	"github.com/pake-go/pake-lib/parser"
+)
+
+const script = `say setup
+target build
+    say build
+    say more
+end`
+
+type say struct {
+	args []string
+}
+
+func (s *say) Execute(cfg *config.Config, logger *log.Logger) error {
+	suffix, _ := cfg.Get("suffix")
+	logger.Println(strings.Join(s.args, " ") + suffix)
+	return nil
+}
+
+type sayValidator struct {
+}
+
+func (sv *sayValidator) CanHandle(line string) bool {
+	return strings.HasPrefix(line, "say ")
+}
+
+func (sv *sayValidator) ValidateArgs(args []string) error {
+	return nil
+}
+
+type commentValidator struct {
+}
+
+func (cv *commentValidator) IsValid(line string) bool {
+	return strings.HasPrefix(line, "# ")
+}
+
+// A client sends requests to a Server and reads the messages it writes.
+type client struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	seq    int
+	output []string
+}
+
+// send sends a request with the given command and arguments.
+func (c *client) send(command string, arguments interface{}) {
+	c.seq++
+	req := map[string]interface{}{"seq": c.seq, "type": "request", "command": command}
+	if arguments != nil {
+		req["arguments"] = arguments
+	}
+	if err := writeMessage(c.w, req); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next reads the next message that is not an output event, collecting the output.
+func (c *client) next() map[string]interface{} {
+	for {
+		content, err := readMessage(c.r)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		message := make(map[string]interface{})
+		if err := json.Unmarshal(content, &message); err != nil {
+			c.t.Fatal(err)
+		}
+		if message["event"] != "output" {
+			return message
+		}
+		body := message["body"].(map[string]interface{})
+		c.output = append(c.output, body["output"].(string))
+	}
+}
+
+// expect reads the next message and checks that it is the response to the given command or the
+// given event, returning its body.
+func (c *client) expect(kind, name string) map[string]interface{} {
+	c.t.Helper()
+	message := c.next()
+	if message["type"] != kind || (message["command"] != name && message["event"] != name) {
+		c.t.Fatalf("Expected the %s %s but got %+v", name, kind, message)
+	}
+	if kind == "response" && message["success"] != true {
+		c.t.Fatalf("Expected the %s request to succeed but got %+v", name, message)
+	}
+	body, _ := message["body"].(map[string]interface{})
+	return body
+}
+
+// request sends a request and returns the body of its response.
+func (c *client) request(command string, arguments interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.send(command, arguments)
+	return c.expect("response", command)
+}
+
+// newSession starts a Server for the given script and returns a client connected to it along
+// with the path of the script.
+func newSession(t *testing.T, contents string) (*client, string, chan error) {
+	path := filepath.Join(t.TempDir(), "pakefile")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New([]pakelib.CommandCandidate{{
+		Validator:   &sayValidator{},
+		Constructor: func(args []string) pakelib.Command { return &say{args} },
+	}}, &commentValidator{})
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- New(p).Serve(requests, responses)
+		responses.Close()
+	}()
+	return &client{t: t, w: requestWriter, r: bufio.NewReader(responseReader)}, path, done
+}
+
+func TestServe(t *testing.T) {
+	c, path, done := newSession(t, script)
+
+	capabilities := c.request("initialize", map[string]string{"adapterID": "pake"})
+	if capabilities["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("Unexpected capabilities: %+v", capabilities)
+	}
+	c.expect("event", "initialized")
+	c.request("launch", map[string]interface{}{"program": path, "targets": []string{"build"}})
+	breakpoints := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 3}},
+	})
+	if len(breakpoints["breakpoints"].([]interface{})) != 1 {
+		t.Errorf("Unexpected breakpoints: %+v", breakpoints)
+	}
+	c.request("configurationDone", nil)
+
+	stopped := c.expect("event", "stopped")
+	if stopped["reason"] != "breakpoint" {
+		t.Errorf("Expected to stop at a breakpoint but got %+v", stopped)
+	}
+	threads := c.request("threads", nil)["threads"].([]interface{})
+	if len(threads) != 1 {
+		t.Errorf("Expected 1 thread but got %+v", threads)
+	}
+	var frames []string
+	stackTrace := c.request("stackTrace", map[string]int{"threadId": 1})
+	for _, frame := range stackTrace["stackFrames"].([]interface{}) {
+		frame := frame.(map[string]interface{})
+		path := frame["source"].(map[string]interface{})["path"].(string)
+		frames = append(frames, fmt.Sprintf("%s %s:%v", frame["name"], filepath.Base(path),
+			frame["line"]))
+	}
+	expectedFrames := []string{"*dap.say pakefile:3", "target build pakefile:2"}
+	if !reflect.DeepEqual(frames, expectedFrames) {
+		t.Errorf("Expected %+q but got %+q", expectedFrames, frames)
+	}
+	c.request("scopes", map[string]int{"frameId": 1})
+	c.request("setVariable", map[string]interface{}{
+		"variablesReference": configReference, "name": "suffix", "value": "!",
+	})
+	variables := c.request("variables", map[string]int{"variablesReference": configReference})
+	expectedVariables := []interface{}{map[string]interface{}{
+		"name": "suffix", "value": "!", "variablesReference": 0.0,
+		"presentationHint": map[string]interface{}{
+			"kind": "property", "attributes": []interface{}{"permanent"},
+		},
+	}}
+	if !reflect.DeepEqual(variables["variables"], expectedVariables) {
+		t.Errorf("Expected %+v but got %+v", expectedVariables, variables["variables"])
+	}
+
+	c.request("next", map[string]int{"threadId": 1})
+	stopped = c.expect("event", "stopped")
+	if stopped["reason"] != "step" {
+		t.Errorf("Expected to stop after a step but got %+v", stopped)
+	}
+	c.request("continue", map[string]int{"threadId": 1})
+	c.expect("event", "terminated")
+	exited := c.expect("event", "exited")
+	if exited["exitCode"] != 0.0 {
+		t.Errorf("Expected an exit code of 0 but got %+v", exited)
+	}
+	c.request("disconnect", nil)
+
+	expectedOutput := []string{"setup\n", "build!\n", "more!\n"}
+	if !reflect.DeepEqual(c.output, expectedOutput) {
+		t.Errorf("Expected %+q but got %+q", expectedOutput, c.output)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVariablesOf(t *testing.T) {
+	cfg := config.New()
+	cfg.Declare(config.Flag{Name: "retries", Type: config.Int, Default: "3"})
+	cfg.Declare(config.Flag{Name: "suffix", Type: config.String})
+	if err := cfg.SetFor("suffix", "!", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedVariables := []variable{
+		{Name: "retries", Value: "3", Type: "int", PresentationHint: &variablePresentationHint{
+			Kind: "property", Attributes: []string{"default"},
+		}},
+		{Name: "suffix", Value: "!", Type: "string", PresentationHint: &variablePresentationHint{
+			Kind: "property", Attributes: []string{"temporary", "2 left"},
+		}},
+	}
+	if variables := variablesOf(cfg); !reflect.DeepEqual(variables, expectedVariables) {
+		t.Errorf("Expected %+v but got %+v", expectedVariables, variables)
+	}
+}
+
+func TestServe_breakpointsbeforelaunch(t *testing.T) {
+	c, path, done := newSession(t, script)
+
+	c.request("initialize", nil)
+	c.expect("event", "initialized")
+	breakpoints := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 2}, {"line": 4}},
+	})
+	for _, b := range breakpoints["breakpoints"].([]interface{}) {
+		if b.(map[string]interface{})["verified"] != false {
+			t.Errorf("Expected %+v to not be verified before launch", b)
+		}
+	}
+	c.send("launch", map[string]interface{}{
+		"program": path, "targets": []string{"build"}, "config": map[string]string{"suffix": "?"},
+	})
+	var verified []bool
+	for i := 0; i < 2; i++ {
+		event := c.expect("event", "breakpoint")
+		verified = append(verified, event["breakpoint"].(map[string]interface{})["verified"] == true)
+	}
+	expectedVerified := []bool{false, true}
+	if !reflect.DeepEqual(verified, expectedVerified) {
+		t.Errorf("Expected %+v but got %+v", expectedVerified, verified)
+	}
+	c.expect("response", "launch")
+	c.request("configurationDone", nil)
+
+	if stopped := c.expect("event", "stopped"); stopped["reason"] != "breakpoint" {
+		t.Errorf("Expected to stop at a breakpoint but got %+v", stopped)
+	}
+	c.request("continue", map[string]int{"threadId": 1})
+	c.expect("event", "terminated")
+	c.expect("event", "exited")
+	c.request("disconnect", nil)
+
+	expectedOutput := []string{"setup?\n", "build?\n", "more?\n"}
+	if !reflect.DeepEqual(c.output, expectedOutput) {
+		t.Errorf("Expected %+q but got %+q", expectedOutput, c.output)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServe_disconnectwhilepaused(t *testing.T) {
+	c, path, done := newSession(t, script)
+
+	c.request("initialize", nil)
+	c.expect("event", "initialized")
+	c.request("launch", map[string]interface{}{
+		"program": path, "targets": []string{"build"}, "stopOnEntry": true,
+	})
+	c.request("configurationDone", nil)
+	if stopped := c.expect("event", "stopped"); stopped["reason"] != "entry" {
+		t.Errorf("Expected to stop on entry but got %+v", stopped)
+	}
+	c.send("disconnect", nil)
+	c.expect("event", "terminated")
+	c.expect("event", "exited")
+	c.expect("response", "disconnect")
+
+	if len(c.output) != 0 {
+		t.Errorf("Expected no output but got %+q", c.output)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServe_errors(t *testing.T) {
+	c, path, _ := newSession(t, script)
+
+	c.request("initialize", nil)
+	c.expect("event", "initialized")
+	for _, req := range []struct {
+		command   string
+		arguments interface{}
+	}{
+		{"configurationDone", nil},
+		{"launch", map[string]interface{}{"program": path, "targets": []string{"test"}}},
+		{"continue", map[string]int{"threadId": 1}},
+		{"stepOut", map[string]int{"threadId": 1}},
+	} {
+		c.send(req.command, req.arguments)
+		message := c.next()
+		if message["command"] != req.command || message["success"] != false {
+			t.Errorf("Expected the %s request to fail but got %+v", req.command, message)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+// Package debugger provides a step debugger for scripts executed by executor.Executor, with
+// breakpoints, stepping and inspection and modification of the Config whenever the script is
+// paused.
+package debugger
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+	"github.com/pake-go/pake-lib/executor"
+)
+
+// A Breakpoint pauses the script before a command is executed.
+type Breakpoint struct {
+	// ID identifies the breakpoint within its Debugger, starting at 1.
+	ID int
+	// Position is the position of the commands the breakpoint pauses at.  A Position without
+	// a File matches the line in every script.  It is ignored if Command is set.
+	Position pakelib.Position
+	// Command is the name of the commands the breakpoint pauses at, either the type of the
+	// command, such as "*main.say", or the name of the type, such as "say".
+	Command string
+}
+
+// String returns the position or command name the breakpoint pauses at.
+func (b Breakpoint) String() string {
+	if b.Command != "" {
+		return b.Command
+	}
+	return b.Position.String()
+}
+
+// matches checks to see if the breakpoint pauses at the given command and position.
+func (b Breakpoint) matches(command pakelib.Command, pos pakelib.Position) bool {
+	if b.Command != "" {
+		name := fmt.Sprintf("%T", command)
+		return b.Command == name || b.Command == name[strings.LastIndex(name, ".")+1:]
+	}
+	return b.Position.Line == pos.Line && (b.Position.File == "" || b.Position.File == pos.File)
+}
+
+// ParseBreakpoint parses a breakpoint given as "file:line", as a line number matching the line
+// in every script or as the name of a command.
+func ParseBreakpoint(spec string) (Breakpoint, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Breakpoint{}, fmt.Errorf("Can't set a breakpoint without a position or command")
+	}
+	if line, err := strconv.Atoi(spec); err == nil {
+		return Breakpoint{Position: pakelib.Position{Line: line}}, nil
+	}
+	if colon := strings.LastIndex(spec, ":"); colon != -1 {
+		if line, err := strconv.Atoi(spec[colon+1:]); err == nil {
+			return Breakpoint{Position: pakelib.Position{File: spec[:colon], Line: line}}, nil
+		}
+	}
+	return Breakpoint{Command: spec}, nil
+}
+
+// The reasons the script was paused.
+const (
+	// ReasonEntry is the reason the script is paused before its first command when
+	// StopOnEntry was called.
+	ReasonEntry = "entry"
+	// ReasonBreakpoint is the reason the script is paused at a breakpoint.
+	ReasonBreakpoint = "breakpoint"
+	// ReasonStep is the reason the script is paused after Step or Next.
+	ReasonStep = "step"
+	// ReasonPause is the reason the script is paused after Pause.
+	ReasonPause = "pause"
+)
+
+// A Stop describes where the script is paused.
+type Stop struct {
+	// Reason is why the script is paused.
+	Reason string
+	// Breakpoint is the breakpoint the script is paused at, if Reason is ReasonBreakpoint.
+	Breakpoint Breakpoint
+	// Command is the command that is executed once the script is resumed.
+	Command pakelib.Command
+	// Position is the position of the command.
+	Position pakelib.Position
+	// Stack is the blocks the command is executed in, outermost first.
+	Stack []executor.Frame
+	// Config is the Config the command is executed with.  It may be inspected and modified
+	// until the script is resumed.
+	Config *config.Config
+}
+
+// The ways the script is resumed.
+type mode int
+
+const (
+	// Run until a breakpoint is reached.
+	continueMode mode = iota
+	// Pause before the next command.
+	stepMode
+	// Pause before the next command that is not in a block started after the stop.
+	nextMode
+	// Execute no more commands.
+	terminateMode
+)
+
+// A Debugger pauses a script executed by the Executors given its Option at breakpoints and
+// after each step, and lets a caller inspect and modify the Config while the script is paused.
+// A typical session starts the script with Start, and then repeatedly calls Wait followed by
+// Continue, Step or Next until Wait reports that the script has finished.
+type Debugger struct {
+	// Guards every field below.
+	mu sync.Mutex
+	// Represents the breakpoints keyed by ID.
+	breakpoints map[int]Breakpoint
+	// Represents the ID given to the next breakpoint.
+	nextID int
+	// Represents how the script was last resumed.
+	mode mode
+	// Represents the depth of the call stack when Next was called.
+	depth int
+	// Represents whether the script pauses before its next command.
+	pauseRequested bool
+	// Represents whether the script pauses before its first command.
+	stopOnEntry bool
+	// Represents where the script is paused, or nil if it is running.
+	current *Stop
+	// Represents whether the script has been started.
+	started bool
+	// Receives every stop of the script and is closed once the script has finished.
+	stops chan Stop
+	// Receives a value every time the script is resumed.
+	resume chan struct{}
+	// Serializes the stops of commands executed at the same time.
+	pause sync.Mutex
+}
+
+// New returns a Debugger without any breakpoints.
+func New() *Debugger {
+	return &Debugger{
+		breakpoints: make(map[int]Breakpoint),
+		nextID:      1,
+		stops:       make(chan Stop),
+		resume:      make(chan struct{}),
+	}
+}
+
+// Option returns the option that makes an Executor pause at the Debugger's breakpoints.  It
+// should be given before any other middleware so that the script is paused before the
+// other middleware sees the command.
+func (d *Debugger) Option() executor.Option {
+	return executor.WithMiddleware(d.middleware)
+}
+
+// AddBreakpoint adds the given breakpoint and returns it with its ID.
+func (d *Debugger) AddBreakpoint(b Breakpoint) Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b.ID = d.nextID
+	d.nextID++
+	d.breakpoints[b.ID] = b
+	return b
+}
+
+// SetBreakpoint parses the given breakpoint with ParseBreakpoint and adds it.
+func (d *Debugger) SetBreakpoint(spec string) (Breakpoint, error) {
+	b, err := ParseBreakpoint(spec)
+	if err != nil {
+		return Breakpoint{}, err
+	}
+	return d.AddBreakpoint(b), nil
+}
+
+// ClearBreakpoint removes the breakpoint with the given ID.
+func (d *Debugger) ClearBreakpoint(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.breakpoints[id]; !ok {
+		return fmt.Errorf("There is no breakpoint %d", id)
+	}
+	delete(d.breakpoints, id)
+	return nil
+}
+
+// ClearBreakpoints removes every breakpoint.
+func (d *Debugger) ClearBreakpoints() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = make(map[int]Breakpoint)
+}
+
+// Breakpoints returns the breakpoints sorted by ID.
+func (d *Debugger) Breakpoints() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sortedBreakpoints()
+}
+
+// sortedBreakpoints returns the breakpoints ordered by ID.  The caller must hold the lock.
+func (d *Debugger) sortedBreakpoints() []Breakpoint {
+	breakpoints := make([]Breakpoint, 0, len(d.breakpoints))
+	for _, b := range d.breakpoints {
+		breakpoints = append(breakpoints, b)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool {
+		return breakpoints[i].ID < breakpoints[j].ID
+	})
+	return breakpoints
+}
+
+// StopOnEntry pauses the script before its first command.  It must be called before Start.
+func (d *Debugger) StopOnEntry() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopOnEntry = true
+}
+
+// Start executes the given function, which executes the script with an Executor given the
+// Debugger's Option, in a new goroutine.  It returns an error if the script has already been
+// started.
+func (d *Debugger) Start(run func()) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started {
+		return fmt.Errorf("The script has already been started")
+	}
+	d.started = true
+	go func() {
+		run()
+		close(d.stops)
+	}()
+	return nil
+}
+
+// Wait waits for the script to pause and returns where it is paused.  It returns false once the
+// script has finished.
+func (d *Debugger) Wait() (Stop, bool) {
+	stop, ok := <-d.stops
+	return stop, ok
+}
+
+// Current returns where the script is paused.  It returns false if the script is not paused.
+func (d *Debugger) Current() (Stop, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.current == nil {
+		return Stop{}, false
+	}
+	return *d.current, true
+}
+
+// Continue resumes the script until it reaches a breakpoint.
+func (d *Debugger) Continue() error {
+	return d.resumeWith(continueMode)
+}
+
+// Step resumes the script until the next command, including the commands of blocks such as
+// targets or procedure calls.
+func (d *Debugger) Step() error {
+	return d.resumeWith(stepMode)
+}
+
+// Next resumes the script until the next command that is not in a block started by the
+// command it is paused at, stepping over targets and procedure calls.
+func (d *Debugger) Next() error {
+	return d.resumeWith(nextMode)
+}
+
+// Terminate resumes the script without executing any of its remaining commands.
+func (d *Debugger) Terminate() error {
+	d.mu.Lock()
+	if d.current == nil {
+		d.mode = terminateMode
+		d.mu.Unlock()
+		return nil
+	}
+	d.mu.Unlock()
+	return d.resumeWith(terminateMode)
+}
+
+// Pause pauses the script before its next command.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pauseRequested = true
+}
+
+// resumeWith resumes the paused script with the given mode.
+func (d *Debugger) resumeWith(m mode) error {
+	d.mu.Lock()
+	if d.current == nil {
+		d.mu.Unlock()
+		return fmt.Errorf("The script is not paused")
+	}
+	d.mode = m
+	d.depth = len(d.current.Stack)
+	d.current = nil
+	d.mu.Unlock()
+	d.resume <- struct{}{}
+	return nil
+}
+
+// stopFor returns why the script should be paused before the given invocation, or an empty
+// string if it should not be paused.  The caller must hold the lock.
+func (d *Debugger) stopFor(inv *executor.Invocation) (string, Breakpoint) {
+	if d.stopOnEntry {
+		d.stopOnEntry = false
+		return ReasonEntry, Breakpoint{}
+	}
+	if d.pauseRequested {
+		d.pauseRequested = false
+		return ReasonPause, Breakpoint{}
+	}
+	for _, b := range d.sortedBreakpoints() {
+		if b.matches(inv.Command, inv.Position) {
+			return ReasonBreakpoint, b
+		}
+	}
+	switch d.mode {
+	case stepMode:
+		return ReasonStep, Breakpoint{}
+	case nextMode:
+		if len(inv.Stack) <= d.depth {
+			return ReasonStep, Breakpoint{}
+		}
+	}
+	return "", Breakpoint{}
+}
+
+// middleware pauses the script before a command if it should be paused and returns
+// executor.ErrTerminated instead of executing the command once the script has been terminated,
+// so that the executor stops without counting the command as executed.
+func (d *Debugger) middleware(next executor.Handler) executor.Handler {
+	return func(inv *executor.Invocation) error {
+		if _, ok := inv.Command.(*pakelib.Comment); ok {
+			return next(inv)
+		}
+		d.pause.Lock()
+		d.mu.Lock()
+		if d.mode == terminateMode {
+			d.mu.Unlock()
+			d.pause.Unlock()
+			return executor.ErrTerminated
+		}
+		reason, b := d.stopFor(inv)
+		if reason != "" {
+			d.current = &Stop{
+				Reason:     reason,
+				Breakpoint: b,
+				Command:    inv.Command,
+				Position:   inv.Position,
+				Stack:      inv.Stack,
+				Config:     inv.Config,
+			}
+			stop := *d.current
+			d.mu.Unlock()
+			d.stops <- stop
+			<-d.resume
+			d.mu.Lock()
+		}
+		terminated := d.mode == terminateMode
+		d.mu.Unlock()
+		d.pause.Unlock()
+		if terminated {
+			return executor.ErrTerminated
+		}
+		return next(inv)
+	}
+}
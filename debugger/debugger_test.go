@@ -0,0 +1,353 @@
+package debugger
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+	"github.com/pake-go/pake-lib/executor"
+)
+
+// A transcript records what the commands of a script said.
+type transcript struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (t *transcript) said() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+type say struct {
+	word       string
+	transcript *transcript
+}
+
+func (s *say) Execute(cfg *config.Config, logger *log.Logger) error {
+	word := s.word
+	if suffix, err := cfg.Get("suffix"); err == nil {
+		word += suffix
+	}
+	s.transcript.mu.Lock()
+	defer s.transcript.mu.Unlock()
+	s.transcript.lines = append(s.transcript.lines, word)
+	return nil
+}
+
+type shout struct {
+	say
+}
+
+// newScript returns a function running a script with a target and the transcript its commands
+// write to.  The script is:
+//
+//	1 say a
+//	2 # call build
+//	3 target build
+//	4     say b
+//	5     shout c
+//	6 end
+//	7 say d
+func newScript(d *Debugger) (func(), *transcript) {
+	t := &transcript{}
+	return func() {
+		e := executor.New(log.New(ioutil.Discard, "", 0), d.Option(),
+			executor.WithFilename("pakefile"))
+		cfg := config.New()
+		e.RunAt([]pakelib.Command{&say{"a", t}, &pakelib.Comment{}},
+			[]pakelib.Position{{File: "pakefile", Line: 1}, {File: "pakefile", Line: 2}}, cfg)
+		end := e.Block("target build", pakelib.Position{File: "pakefile", Line: 3}, nil)
+		e.RunAt([]pakelib.Command{&say{"b", t}, &shout{say{"c", t}}},
+			[]pakelib.Position{{File: "pakefile", Line: 4}, {File: "pakefile", Line: 5}}, cfg)
+		end(nil)
+		e.RunAt([]pakelib.Command{&say{"d", t}},
+			[]pakelib.Position{{File: "pakefile", Line: 7}}, cfg)
+	}, t
+}
+
+// stops resumes the script with the given function every time it pauses and returns where it
+// paused.
+func stops(t *testing.T, d *Debugger, resume func() error) []string {
+	var positions []string
+	for {
+		stop, ok := d.Wait()
+		if !ok {
+			return positions
+		}
+		positions = append(positions, stop.Reason+" "+stop.Position.String())
+		if err := resume(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseBreakpoint(t *testing.T) {
+	for spec, expected := range map[string]Breakpoint{
+		"pakefile:3":   {Position: pakelib.Position{File: "pakefile", Line: 3}},
+		"c:\\pake:12":  {Position: pakelib.Position{File: "c:\\pake", Line: 12}},
+		"7":            {Position: pakelib.Position{Line: 7}},
+		"say":          {Command: "say"},
+		"*main.say":    {Command: "*main.say"},
+		"pakefile:end": {Command: "pakefile:end"},
+	} {
+		b, err := ParseBreakpoint(spec)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(b, expected) {
+			t.Errorf("Expected %+v but got %+v", expected, b)
+		}
+	}
+	if _, err := ParseBreakpoint(" "); err == nil {
+		t.Error("Should not be able to parse an empty breakpoint")
+	}
+}
+
+func TestDebugger_breakpoints(t *testing.T) {
+	d := New()
+	run, transcript := newScript(d)
+	d.SetBreakpoint("pakefile:4")
+	d.SetBreakpoint("7")
+	d.SetBreakpoint("shout")
+	removed, _ := d.SetBreakpoint("1")
+	if err := d.ClearBreakpoint(removed.ID); err != nil {
+		t.Error(err)
+	}
+
+	d.Start(run)
+	expectedStops := []string{"breakpoint pakefile:4", "breakpoint pakefile:5",
+		"breakpoint pakefile:7"}
+	if positions := stops(t, d, d.Continue); !reflect.DeepEqual(positions, expectedStops) {
+		t.Errorf("Expected %+q but got %+q", expectedStops, positions)
+	}
+	expectedTranscript := []string{"a", "b", "c", "d"}
+	if !reflect.DeepEqual(transcript.said(), expectedTranscript) {
+		t.Errorf("Expected %+q but got %+q", expectedTranscript, transcript.said())
+	}
+}
+
+func TestDebugger_overlappingbreakpoints(t *testing.T) {
+	d := New()
+	run, _ := newScript(d)
+	first, _ := d.SetBreakpoint("pakefile:5")
+	for i := 0; i < 8; i++ {
+		d.SetBreakpoint("shout")
+		d.SetBreakpoint("5")
+	}
+
+	d.Start(run)
+	for {
+		stop, ok := d.Wait()
+		if !ok {
+			break
+		}
+		if stop.Breakpoint.ID != first.ID {
+			t.Errorf("Expected breakpoint %d but got %+v", first.ID, stop.Breakpoint)
+		}
+		if err := d.Continue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDebugger_step(t *testing.T) {
+	d := New()
+	run, _ := newScript(d)
+	d.StopOnEntry()
+
+	d.Start(run)
+	expectedStops := []string{"entry pakefile:1", "step pakefile:4", "step pakefile:5",
+		"step pakefile:7"}
+	if positions := stops(t, d, d.Step); !reflect.DeepEqual(positions, expectedStops) {
+		t.Errorf("Expected %+q but got %+q", expectedStops, positions)
+	}
+}
+
+func TestDebugger_next(t *testing.T) {
+	d := New()
+	run, _ := newScript(d)
+	d.StopOnEntry()
+
+	d.Start(run)
+	expectedStops := []string{"entry pakefile:1", "step pakefile:7"}
+	if positions := stops(t, d, d.Next); !reflect.DeepEqual(positions, expectedStops) {
+		t.Errorf("Expected %+q but got %+q", expectedStops, positions)
+	}
+}
+
+func TestDebugger_stack(t *testing.T) {
+	d := New()
+	run, _ := newScript(d)
+	d.SetBreakpoint("5")
+
+	d.Start(run)
+	stop, ok := d.Wait()
+	if !ok {
+		t.Fatal("The script should have paused")
+	}
+	expectedStack := []executor.Frame{
+		{Name: "target build", Position: pakelib.Position{File: "pakefile", Line: 3}},
+	}
+	if !reflect.DeepEqual(stop.Stack, expectedStack) {
+		t.Errorf("Expected %+v but got %+v", expectedStack, stop.Stack)
+	}
+	d.Continue()
+	if _, ok := d.Wait(); ok {
+		t.Error("The script should have finished")
+	}
+}
+
+func TestDebugger_modifyconfig(t *testing.T) {
+	d := New()
+	run, transcript := newScript(d)
+	d.SetBreakpoint("4")
+
+	d.Start(run)
+	stop, _ := d.Wait()
+	if err := stop.Config.SetFor("suffix", "!", 0); err != nil {
+		t.Error(err)
+	}
+	d.Continue()
+	d.Wait()
+
+	expectedTranscript := []string{"a", "b!", "c", "d"}
+	if !reflect.DeepEqual(transcript.said(), expectedTranscript) {
+		t.Errorf("Expected %+q but got %+q", expectedTranscript, transcript.said())
+	}
+}
+
+func TestDebugger_terminate(t *testing.T) {
+	d := New()
+	run, transcript := newScript(d)
+	d.SetBreakpoint("shout")
+
+	d.Start(run)
+	d.Wait()
+	if err := d.Terminate(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := d.Wait(); ok {
+		t.Error("The script should have finished")
+	}
+	expectedTranscript := []string{"a", "b"}
+	if !reflect.DeepEqual(transcript.said(), expectedTranscript) {
+		t.Errorf("Expected %+q but got %+q", expectedTranscript, transcript.said())
+	}
+}
+
+func TestDebugger_terminatenotexecuted(t *testing.T) {
+	d := New()
+	d.StopOnEntry()
+	coverage := executor.NewCoverage()
+	var after []pakelib.Position
+	var runErr error
+	transcript := &transcript{}
+
+	d.Start(func() {
+		e := executor.New(log.New(ioutil.Discard, "", 0), d.Option(),
+			executor.WithCoverage(coverage), executor.WithAfterCommand(
+				func(inv *executor.Invocation, err error) {
+					after = append(after, inv.Position)
+				}))
+		runErr = e.RunAt([]pakelib.Command{&say{"a", transcript}, &say{"b", transcript}},
+			[]pakelib.Position{{Line: 1}, {Line: 2}}, config.New())
+	})
+	d.Wait()
+	if err := d.Terminate(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := d.Wait(); ok {
+		t.Error("The script should have finished")
+	}
+
+	if runErr != executor.ErrTerminated {
+		t.Errorf("Expected %v but got %v", executor.ErrTerminated, runErr)
+	}
+	if len(after) != 0 || len(transcript.said()) != 0 {
+		t.Errorf("Expected no command to be executed but got %+v", after)
+	}
+	expectedLines := []executor.LineCoverage{{Line: 1, Count: 0}, {Line: 2, Count: 0}}
+	if !reflect.DeepEqual(coverage.Lines(""), expectedLines) {
+		t.Errorf("Expected %+v but got %+v", expectedLines, coverage.Lines(""))
+	}
+}
+
+func TestDebugger_notpaused(t *testing.T) {
+	d := New()
+
+	if err := d.Continue(); err == nil {
+		t.Error("Should not be able to continue a script that is not paused")
+	}
+	if err := d.Start(func() {}); err != nil {
+		t.Error(err)
+	}
+	if err := d.Start(func() {}); err == nil {
+		t.Error("Should not be able to start a script twice")
+	}
+}
+
+func TestConsole(t *testing.T) {
+	d := New()
+	run, transcript := newScript(d)
+	input := strings.Join([]string{
+		"break shout",
+		"break pakefile:9",
+		"delete 2",
+		"breakpoints",
+		"step",
+		"print",
+		"continue",
+		"where",
+		"set suffix ?",
+		"print suffix",
+		"next",
+		"bogus",
+		"continue",
+	}, "\n")
+	var output strings.Builder
+
+	if err := NewConsole(d, strings.NewReader(input), &output).Run(run); err != nil {
+		t.Error(err)
+	}
+	expectedOutput := strings.Join([]string{
+		"(pake) Breakpoint 1 at shout",
+		"(pake) Breakpoint 2 at pakefile:9",
+		"(pake) (pake) 1\tshout",
+		"(pake) Paused at pakefile:1 before *debugger.say: entry",
+		"(pake) (pake) Paused at pakefile:5 before *debugger.shout: breakpoint 1",
+		"(pake) #0 pakefile:5",
+		"#1 target build at pakefile:3",
+		"(pake) (pake) suffix = \"?\"",
+		"(pake) Paused at pakefile:7 before *debugger.say: step",
+		"(pake) bogus is not a valid command, try help",
+		"(pake) The script has finished",
+		"",
+	}, "\n")
+	if output.String() != expectedOutput {
+		t.Errorf("Expected %s but got %s", expectedOutput, output.String())
+	}
+	expectedTranscript := []string{"a", "b", "c?", "d?"}
+	if !reflect.DeepEqual(transcript.said(), expectedTranscript) {
+		t.Errorf("Expected %+q but got %+q", expectedTranscript, transcript.said())
+	}
+}
+
+func TestConsole_endofinput(t *testing.T) {
+	d := New()
+	run, transcript := newScript(d)
+	var output strings.Builder
+
+	if err := NewConsole(d, strings.NewReader("step"), &output).Run(run); err != nil {
+		t.Error(err)
+	}
+	if len(transcript.said()) != 0 {
+		t.Errorf("Expected no commands to be executed but got %+q", transcript.said())
+	}
+}
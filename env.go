@@ -0,0 +1,162 @@
+package pakelib
+
+import (
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pake-go/pake-lib/config"
+)
+
+// Env carries everything a command needs from the outside world, so that commands do not
+// reach for os.Stdout, os.Getenv or the real filesystem directly and can be tested with fake
+// streams, environments, filesystems and clocks.
+type Env struct {
+	// Stdin is the reader commands read input from.
+	Stdin io.Reader
+	// Stdout is the writer commands write output to.
+	Stdout io.Writer
+	// Stderr is the writer commands write diagnostics to.
+	Stderr io.Writer
+	// Environ holds the environment variables of the script.
+	Environ map[string]string
+	// Dir is the working directory of the script.
+	Dir string
+	// FS is the filesystem commands read and write files in, relative to Dir.
+	FS FileSystem
+	// Clock is the clock commands read the time from and sleep with.
+	Clock Clock
+	// Services holds the values supplied by the program running the script, such as
+	// clients for remote services, keyed by name.
+	Services map[string]interface{}
+}
+
+// EnvCommand is an optional interface for commands that use an Env instead of reaching for
+// the process's streams, environment, filesystem and clock.  The executor calls ExecuteEnv
+// instead of Execute.
+type EnvCommand interface {
+	// ExecuteEnv would perform the action behind the command using the given Env.
+	ExecuteEnv(*Env, *config.Config, *log.Logger) error
+}
+
+// DefaultEnv returns an Env backed by the standard streams, environment, working directory,
+// filesystem and clock of the process, without any services.
+func DefaultEnv() *Env {
+	environ := make(map[string]string)
+	for _, variable := range os.Environ() {
+		if i := strings.Index(variable, "="); i > 0 {
+			environ[variable[:i]] = variable[i+1:]
+		}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		dir = "."
+	}
+	return &Env{
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		Environ:  environ,
+		Dir:      dir,
+		FS:       OSFileSystem(dir),
+		Clock:    SystemClock{},
+		Services: make(map[string]interface{}),
+	}
+}
+
+// Getenv returns the value of the given environment variable, or an empty string if it is
+// not set.
+func (e *Env) Getenv(key string) string {
+	return e.Environ[key]
+}
+
+// Service returns the service supplied under the given name.
+func (e *Env) Service(name string) (interface{}, bool) {
+	service, ok := e.Services[name]
+	return service, ok
+}
+
+// A Clock tells the time and waits.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Sleep waits for the given duration.
+	Sleep(time.Duration)
+}
+
+// SystemClock is the Clock of the system.
+type SystemClock struct {
+}
+
+// Now returns the current time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep waits for the given duration.
+func (SystemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// FileSystem is a filesystem that files can be written to as well as read from.  Names are
+// slash-separated and relative to the root of the filesystem, as with fs.FS.
+type FileSystem interface {
+	fs.FS
+	// WriteFile writes the given data to the named file, creating or truncating it.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+	// MkdirAll creates the named directory along with any parents that do not exist.
+	MkdirAll(name string, perm fs.FileMode) error
+}
+
+// osFileSystem is a FileSystem backed by a directory of the real filesystem.
+type osFileSystem struct {
+	fs.FS
+	// Represents the directory the filesystem is rooted at.
+	dir string
+}
+
+// OSFileSystem returns a FileSystem rooted at the given directory of the real filesystem.
+func OSFileSystem(dir string) FileSystem {
+	return &osFileSystem{FS: os.DirFS(dir), dir: dir}
+}
+
+// join returns the path of the named file in the real filesystem.
+func (f *osFileSystem) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(f.dir, filepath.FromSlash(name)), nil
+}
+
+// WriteFile writes the given data to the named file, creating or truncating it.
+func (f *osFileSystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	filename, err := f.join("write", name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, perm)
+}
+
+// Remove removes the named file or empty directory.
+func (f *osFileSystem) Remove(name string) error {
+	filename, err := f.join("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// MkdirAll creates the named directory along with any parents that do not exist.
+func (f *osFileSystem) MkdirAll(name string, perm fs.FileMode) error {
+	filename, err := f.join("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(filename, perm)
+}
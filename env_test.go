@@ -0,0 +1,53 @@
+package pakelib
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestDefaultEnv(t *testing.T) {
+	os.Setenv("PAKE_ENV_TEST", "value")
+	defer os.Unsetenv("PAKE_ENV_TEST")
+
+	env := DefaultEnv()
+
+	if env.Getenv("PAKE_ENV_TEST") != "value" {
+		t.Errorf("Expected %s but got %s", "value", env.Getenv("PAKE_ENV_TEST"))
+	}
+	dir, _ := os.Getwd()
+	if env.Dir != dir {
+		t.Errorf("Expected %s but got %s", dir, env.Dir)
+	}
+	if _, ok := env.Service("missing"); ok {
+		t.Error("Expected no services")
+	}
+}
+
+func TestOSFileSystem(t *testing.T) {
+	fsys := OSFileSystem(t.TempDir())
+
+	if err := fsys.MkdirAll("a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("a/b/c", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content, err := fs.ReadFile(fsys, "a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "content" {
+		t.Errorf("Expected %s but got %s", "content", content)
+	}
+	if err := fsys.WriteFile("../escape", nil, 0644); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Expected %v but got %v", fs.ErrInvalid, err)
+	}
+	if err := fsys.Remove("a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys, "a/b/c"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected %v but got %v", fs.ErrNotExist, err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package envtest provides an in-memory pakelib.FileSystem for testing commands that satisfy
+// pakelib.EnvCommand without touching the real filesystem.
+package envtest
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// A MemoryFileSystem is a pakelib.FileSystem held in memory.  It is safe for concurrent use by
+// multiple goroutines.
+type MemoryFileSystem struct {
+	// Guards files.
+	mu sync.RWMutex
+	// Represents the files and directories keyed by name.
+	files fstest.MapFS
+}
+
+// NewMemoryFileSystem returns a MemoryFileSystem holding the given files, keyed by name.
+func NewMemoryFileSystem(files map[string]string) *MemoryFileSystem {
+	m := &MemoryFileSystem{files: make(fstest.MapFS)}
+	for name, content := range files {
+		m.files[name] = &fstest.MapFile{Data: []byte(content), Mode: 0644}
+	}
+	return m
+}
+
+// Open opens the named file.  The file holds the content the named file had when it was
+// opened, and a directory holds the entries it had when it was opened.
+func (m *MemoryFileSystem) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snapshot := make(fstest.MapFS)
+	if file, ok := m.files[name]; ok {
+		copied := *file
+		snapshot[name] = &copied
+		if !file.Mode.IsDir() {
+			return snapshot.Open(name)
+		}
+	}
+	for fileName, file := range m.files {
+		if name == "." || strings.HasPrefix(fileName, name+"/") {
+			copied := *file
+			snapshot[fileName] = &copied
+		}
+	}
+	return snapshot.Open(name)
+}
+
+// WriteFile writes the given data to the named file, creating or truncating it.  It returns
+// an error if the name is a directory.
+func (m *MemoryFileSystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if file, ok := m.files[name]; ok && file.Mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m.files[name] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: perm,
+		ModTime: time.Now()}
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (m *MemoryFileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for fileName := range m.files {
+		if strings.HasPrefix(fileName, name+"/") {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+		}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// MkdirAll creates the named directory along with any parents that do not exist.
+func (m *MemoryFileSystem) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		if file, ok := m.files[dir]; ok {
+			if !file.Mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+			}
+			continue
+		}
+		m.files[dir] = &fstest.MapFile{Mode: fs.ModeDir | perm}
+	}
+	return nil
+}
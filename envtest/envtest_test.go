@@ -0,0 +1,44 @@
+package envtest
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemoryFileSystem(t *testing.T) {
+	fsys := NewMemoryFileSystem(map[string]string{"a/b": "old"})
+
+	if err := fsys.WriteFile("a/b", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll("c/d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("c/d/e", []byte("e"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "a/b", "c/d/e"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := fs.ReadFile(fsys, "a/b")
+	if string(content) != "new" {
+		t.Errorf("Expected %s but got %s", "new", content)
+	}
+	if err := fsys.Remove("c/d"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected %v but got %v", fs.ErrExist, err)
+	}
+	if err := fsys.MkdirAll("a/b", 0755); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected %v but got %v", fs.ErrExist, err)
+	}
+	if err := fsys.Remove("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := fs.Glob(fsys, "*/*")
+	expectedNames := []string{"c/d"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected %+q but got %+q", expectedNames, names)
+	}
+}
@@ -0,0 +1,193 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// A Checkpoint records where a script failed so that it can be resumed from the failed
+// command instead of being executed again from the start.
+type Checkpoint struct {
+	// ScriptHash is the hash of the script, as returned by HashScript.
+	ScriptHash string `json:"script_hash"`
+	// LastSuccessful is the position of the last command that succeeded before the failed
+	// command, or the zero Position if there is none.
+	LastSuccessful pakelib.Position `json:"last_successful"`
+	// Failed is the position of the first command that failed.
+	Failed pakelib.Position `json:"failed"`
+	// Error is the error the failed command returned.
+	Error string `json:"error"`
+	// Config is the state of the Config right before the failed command was executed,
+	// including temporary values and their ages.
+	Config config.State `json:"config"`
+}
+
+// HashScript returns the hash of the given script recorded in checkpoints.
+func HashScript(script []byte) string {
+	sum := sha256.Sum256(script)
+	return hex.EncodeToString(sum[:])
+}
+
+// WithCheckpoint writes a Checkpoint to the given file when a command fails, so that the
+// script can be resumed with Resume.  The script is the content the commands were parsed
+// from and is only used to detect changes to the script.  The commands after the one that
+// failed are not executed, so resuming never executes a command that succeeded again, except
+// with WithConcurrency for the commands executed at the same time as the one that failed.
+// The file is replaced atomically and is removed once the Executor has executed commands
+// without any failure, such as after a successful Resume.
+func WithCheckpoint(filename string, script []byte) Option {
+	return func(e *Executor) {
+		e.checkpointFile = filename
+		e.scriptHash = HashScript(script)
+	}
+}
+
+// ReadCheckpoint reads the Checkpoint written to the given file.
+func ReadCheckpoint(filename string) (*Checkpoint, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, fmt.Errorf("Can't read the checkpoint in %s: %s", filename, err.Error())
+	}
+	return &checkpoint, nil
+}
+
+// Resume is the same as Run but restores the Config from the checkpoint written by a previous
+// Executor with the same WithCheckpoint options and only executes the commands from the one
+// that failed onwards.  Restoring the Config notifies its observers of the values that
+// change.  It returns an error without executing anything if there is no checkpoint, if the
+// script has changed since the checkpoint was written or if the failed command is not one of
+// the given commands, and otherwise returns the error of the first command that failed.
+func (e *Executor) Resume(commands []pakelib.Command, cfg *config.Config) error {
+	return e.ResumeAt(commands, pakelib.Positions(e.filename, len(commands)), cfg)
+}
+
+// ResumeAt is the same as Resume but uses the given position for each command, like RunAt.
+func (e *Executor) ResumeAt(commands []pakelib.Command, positions []pakelib.Position,
+	cfg *config.Config) error {
+	if e.checkpointFile == "" {
+		return fmt.Errorf("Can't resume without a checkpoint file")
+	}
+	checkpoint, err := ReadCheckpoint(e.checkpointFile)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("There is no checkpoint to resume from in %s", e.checkpointFile)
+	}
+	if err != nil {
+		return err
+	}
+	if checkpoint.ScriptHash != e.scriptHash {
+		return fmt.Errorf("The script has changed since the checkpoint in %s was written",
+			e.checkpointFile)
+	}
+	start := -1
+	for i, pos := range positions {
+		if pos == checkpoint.Failed {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return fmt.Errorf("Can't find the command at %s to resume from", checkpoint.Failed)
+	}
+	if err := cfg.SetState(checkpoint.Config); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.lastSuccessful = checkpoint.LastSuccessful
+	e.mu.Unlock()
+	return e.RunAt(commands[start:], positions[start:], cfg)
+}
+
+// checkpoint records the result of the command at the given position, which was executed with
+// a Config in the given state, and writes a Checkpoint if it is the first command to fail.
+func (e *Executor) checkpoint(pos pakelib.Position, state config.State, err error) {
+	if e.checkpointFile == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err == nil {
+		e.lastSuccessful = pos
+		return
+	}
+	if e.checkpointed {
+		return
+	}
+	e.checkpointed = true
+	checkpoint := &Checkpoint{
+		ScriptHash:     e.scriptHash,
+		LastSuccessful: e.lastSuccessful,
+		Failed:         pos,
+		Error:          err.Error(),
+		Config:         state,
+	}
+	content, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err == nil {
+		err = writeFileAtomically(e.checkpointFile, content)
+	}
+	if err != nil {
+		e.logger.Printf("Can't write the checkpoint to %s: %s", e.checkpointFile, err.Error())
+	}
+}
+
+// writeFileAtomically writes the content to a temporary file in the directory of the given
+// file and renames it to the given file, so that the file is never left partially written.
+func writeFileAtomically(filename string, content []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// stopsAtFailure checks to see if the commands after one that failed must not be executed.
+func (e *Executor) stopsAtFailure() bool {
+	return e.checkpointFile != ""
+}
+
+// removeCheckpoint removes the checkpoint file once commands have been executed without any
+// failure.
+func (e *Executor) removeCheckpoint() {
+	if e.checkpointFile == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.checkpointed {
+		return
+	}
+	if err := os.Remove(e.checkpointFile); err != nil && !os.IsNotExist(err) {
+		e.logger.Printf("Can't remove the checkpoint %s: %s", e.checkpointFile, err.Error())
+	}
+}
+
+// stateFor returns the state of the given Config if the Executor writes checkpoints.
+func (e *Executor) stateFor(cfg *config.Config) config.State {
+	if e.checkpointFile == "" {
+		return config.State{}
+	}
+	return cfg.State()
+}
@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+type setColor struct {
+}
+
+func (sc *setColor) Execute(cfg *config.Config, logger *log.Logger) error {
+	return cfg.SetFor("color", "blue", 2)
+}
+
+// A colorRecorder records the color it was executed with and fails until it is fixed.
+type colorRecorder struct {
+	colors *[]string
+	broken *bool
+}
+
+func (cr *colorRecorder) Execute(cfg *config.Config, logger *log.Logger) error {
+	color, _ := cfg.Get("color")
+	*cr.colors = append(*cr.colors, color)
+	if *cr.broken {
+		return errors.New("Broken")
+	}
+	return nil
+}
+
+const checkpointScript = "setColor\nrecord\nrecord\n"
+
+// newCheckpointScript returns the commands of checkpointScript, the colors they record and
+// whether the second command fails.
+func newCheckpointScript() ([]pakelib.Command, *[]string, *bool) {
+	colors := []string{}
+	broken := true
+	return []pakelib.Command{
+		&setColor{},
+		&colorRecorder{colors: &colors, broken: &broken},
+		&colorRecorder{colors: &colors, broken: new(bool)},
+	}, &colors, &broken
+}
+
+func TestWithCheckpoint(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "checkpoint.json")
+	logger := log.New(ioutil.Discard, "", 0)
+	commands, colors, broken := newCheckpointScript()
+
+	capturer.CaptureOutput(func() {
+		New(logger, WithCheckpoint(filename, []byte(checkpointScript)),
+			WithFilename("pakefile")).Run(commands, config.New())
+	})
+	checkpoint, err := ReadCheckpoint(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Failed != (pakelib.Position{File: "pakefile", Line: 2}) ||
+		checkpoint.LastSuccessful != (pakelib.Position{File: "pakefile", Line: 1}) ||
+		checkpoint.Error != "Broken" ||
+		checkpoint.ScriptHash != HashScript([]byte(checkpointScript)) {
+		t.Errorf("Unexpected checkpoint %+v", checkpoint)
+	}
+	expectedColors := []string{"blue"}
+	if !reflect.DeepEqual(*colors, expectedColors) {
+		t.Errorf("Expected %+q but got %+q", expectedColors, *colors)
+	}
+	files, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil || len(files) != 1 {
+		t.Errorf("Expected only the checkpoint to be written but got %+v (%v)", files, err)
+	}
+
+	*colors = nil
+	*broken = false
+	cfg := config.New()
+	history := config.NewHistory(cfg)
+	var resumeErr error
+	capturer.CaptureOutput(func() {
+		resumeErr = New(logger, WithCheckpoint(filename, []byte(checkpointScript)),
+			WithFilename("pakefile")).Resume(commands, cfg)
+	})
+	if resumeErr != nil {
+		t.Fatal(resumeErr)
+	}
+	expectedColors = []string{"blue", "blue"}
+	if !reflect.DeepEqual(*colors, expectedColors) {
+		t.Errorf("Expected %+q but got %+q", expectedColors, *colors)
+	}
+	changes := history.Changes("color")
+	if len(changes) == 0 || changes[0].Cause != config.CauseRestore || changes[0].New != "blue" {
+		t.Errorf("Expected the restored color to be published but got %+v", changes)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed but got %v", err)
+	}
+}
+
+func TestResume_changedscript(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "checkpoint.json")
+	logger := log.New(ioutil.Discard, "", 0)
+	commands, colors, _ := newCheckpointScript()
+	capturer.CaptureOutput(func() {
+		New(logger, WithCheckpoint(filename, []byte(checkpointScript))).Run(commands,
+			config.New())
+	})
+
+	*colors = nil
+	err := New(logger, WithCheckpoint(filename, []byte("record\n"))).Resume(commands,
+		config.New())
+	if err == nil {
+		t.Error("Should not be able to resume a script that has changed")
+	}
+	if len(*colors) != 0 {
+		t.Errorf("Expected no commands to be executed but got %+q", *colors)
+	}
+}
+
+func TestResume_nocheckpoint(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "checkpoint.json")
+	logger := log.New(ioutil.Discard, "", 0)
+	commands, _, _ := newCheckpointScript()
+
+	err := New(logger, WithCheckpoint(filename, []byte(checkpointScript))).Resume(commands,
+		config.New())
+	if err == nil {
+		t.Error("Should not be able to resume without a checkpoint")
+	}
+	if err := New(logger).Resume(commands, config.New()); err == nil {
+		t.Error("Should not be able to resume without a checkpoint file")
+	}
+}
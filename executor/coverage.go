@@ -0,0 +1,288 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	pakelib "github.com/pake-go/pake-lib"
+)
+
+// A Coverage counts how many times the commands at each position were executed by the
+// Executors it is given to.  Positions of comments are not counted.  A Coverage is safe for
+// concurrent use by multiple goroutines.
+type Coverage struct {
+	// Guards hits.
+	mu sync.Mutex
+	// Represents how many times the command at each position was executed.  Positions that
+	// may be executed but were not are recorded with a count of 0.
+	hits map[pakelib.Position]int
+}
+
+// NewCoverage returns a Coverage without any positions.
+func NewCoverage() *Coverage {
+	return &Coverage{hits: make(map[pakelib.Position]int)}
+}
+
+// WithCoverage records the positions of the commands given to the Executor and how many times
+// they were executed in the given Coverage.  Commands skipped because their outputs are up to
+// date are not counted as executed.
+func WithCoverage(c *Coverage) Option {
+	return func(e *Executor) {
+		e.coverage = c
+	}
+}
+
+// Reachable records the given positions of the given commands as positions that may be
+// executed, so that they are reported as not covered if they never are, such as the commands
+// of targets or procedures that are never called.  It does nothing if the Executor has no
+// Coverage.
+func (e *Executor) Reachable(commands []pakelib.Command, positions []pakelib.Position) {
+	if e.coverage == nil {
+		return
+	}
+	e.coverage.mu.Lock()
+	defer e.coverage.mu.Unlock()
+	for i, command := range commands {
+		if _, ok := command.(*pakelib.Comment); ok {
+			continue
+		}
+		if _, ok := e.coverage.hits[positions[i]]; !ok {
+			e.coverage.hits[positions[i]] = 0
+		}
+	}
+}
+
+// hit counts one execution of the given command at the given position.
+func (c *Coverage) hit(command pakelib.Command, pos pakelib.Position) {
+	if _, ok := command.(*pakelib.Comment); ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hits[pos]++
+}
+
+// A LineCoverage holds how many times the commands on a line of a script were executed.
+type LineCoverage struct {
+	// Line is the line number, starting at 1.
+	Line int
+	// Count is how many times the commands on the line were executed.
+	Count int
+}
+
+// Files returns the names of the scripts with recorded positions, sorted by name.
+func (c *Coverage) Files() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := make(map[string]bool)
+	var files []string
+	for pos := range c.hits {
+		if !seen[pos.File] {
+			seen[pos.File] = true
+			files = append(files, pos.File)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Lines returns the recorded lines of the given script, sorted by line number.
+func (c *Coverage) Lines(file string) []LineCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var lines []LineCoverage
+	for pos, count := range c.hits {
+		if pos.File == file {
+			lines = append(lines, LineCoverage{Line: pos.Line, Count: count})
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].Line < lines[j].Line
+	})
+	return lines
+}
+
+// Percent returns the percentage of the recorded lines of the given script that were executed
+// at least once, or 0 if no lines were recorded.
+func (c *Coverage) Percent(file string) float64 {
+	lines := c.Lines(file)
+	if len(lines) == 0 {
+		return 0
+	}
+	covered := 0
+	for _, line := range lines {
+		if line.Count != 0 {
+			covered++
+		}
+	}
+	return 100 * float64(covered) / float64(len(lines))
+}
+
+// Merge adds the counts of the given Coverage to the Coverage, so that the coverage of
+// multiple runs can be reported together.
+func (c *Coverage) Merge(other *Coverage) {
+	other.mu.Lock()
+	hits := make(map[pakelib.Position]int, len(other.hits))
+	for pos, count := range other.hits {
+		hits[pos] = count
+	}
+	other.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pos, count := range hits {
+		c.hits[pos] += count
+	}
+}
+
+// coverageMode is the first line of every coverage profile.
+const coverageMode = "mode: count"
+
+// WriteProfile writes the Coverage to the given writer as a coverage profile.  The profile
+// starts with a "mode: count" line followed by one "file:line count" line per recorded line,
+// sorted by file and line.
+func (c *Coverage) WriteProfile(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, coverageMode); err != nil {
+		return err
+	}
+	for _, file := range c.Files() {
+		for _, line := range c.Lines(file) {
+			if _, err := fmt.Fprintf(w, "%s:%d %d\n", file, line.Line, line.Count); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadProfile adds the counts of the coverage profile read from the given reader to the
+// Coverage, so that the profiles of multiple runs can be merged.  It returns an error naming
+// the line of the profile that can't be read.
+func (c *Coverage) LoadProfile(r io.Reader) error {
+	hits := make(map[pakelib.Position]int)
+	scanner := bufio.NewScanner(r)
+	linenum := 0
+	for scanner.Scan() {
+		linenum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || (linenum == 1 && line == coverageMode) {
+			continue
+		}
+		pos, count, err := parseCoverageLine(line)
+		if err != nil {
+			return fmt.Errorf("An error occured on line %d: %s", linenum, err.Error())
+		}
+		hits[pos] += count
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pos, count := range hits {
+		c.hits[pos] += count
+	}
+	return nil
+}
+
+// parseCoverageLine parses a "file:line count" line of a coverage profile.
+func parseCoverageLine(line string) (pakelib.Position, int, error) {
+	space := strings.LastIndex(line, " ")
+	colon := strings.LastIndex(line[:space+1], ":")
+	if space == -1 || colon == -1 {
+		return pakelib.Position{}, 0, fmt.Errorf("Expected file:line count but got %q", line)
+	}
+	linenum, err := strconv.Atoi(line[colon+1 : space])
+	if err != nil {
+		return pakelib.Position{}, 0, fmt.Errorf("Can't use %q as a line number",
+			line[colon+1:space])
+	}
+	count, err := strconv.Atoi(line[space+1:])
+	if err != nil {
+		return pakelib.Position{}, 0, fmt.Errorf("Can't use %q as a count", line[space+1:])
+	}
+	return pakelib.Position{File: line[:colon], Line: linenum}, count, nil
+}
+
+// An annotatedLine is a line of a script shown in the HTML report.
+type annotatedLine struct {
+	Number int
+	Text   string
+	Count  int
+	// Class is "covered", "uncovered" or an empty string for lines without commands.
+	Class string
+}
+
+// An annotatedFile is a script shown in the HTML report.
+type annotatedFile struct {
+	Name    string
+	Percent float64
+	Lines   []annotatedLine
+}
+
+// coverageTemplate renders the HTML report.
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Script coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; margin: 0; }
+td { padding: 0 0.5em; vertical-align: top; }
+.number, .count { color: #888; text-align: right; }
+.covered { background: #d4f4d4; }
+.uncovered { background: #f8d4d4; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Name}} ({{printf "%.1f" .Percent}}%)</h2>
+<table>
+{{range .Lines}}<tr class="{{.Class}}"><td class="number">{{.Number}}</td><td class="count">{{if .Class}}{{.Count}}{{end}}</td><td><pre>{{.Text}}</pre></td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes an HTML report to the given writer showing the source of every script with
+// recorded positions, read from the given filesystem, with each line annotated with how many
+// times it was executed.  Executed lines are highlighted in green and lines that were never
+// executed in red.  Positions without a file are not reported.
+func (c *Coverage) WriteHTML(w io.Writer, fsys fs.FS) error {
+	var files []annotatedFile
+	for _, file := range c.Files() {
+		if file == "" {
+			continue
+		}
+		source, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		counts := make(map[int]int)
+		for _, line := range c.Lines(file) {
+			counts[line.Line] = line.Count
+		}
+		annotated := annotatedFile{Name: file, Percent: c.Percent(file)}
+		for i, text := range strings.Split(strings.TrimSuffix(string(source), "\n"), "\n") {
+			line := annotatedLine{Number: i + 1, Text: text}
+			if count, ok := counts[i+1]; ok {
+				line.Count = count
+				line.Class = "uncovered"
+				if count != 0 {
+					line.Class = "covered"
+				}
+			}
+			annotated.Lines = append(annotated.Lines, line)
+		}
+		files = append(files, annotated)
+	}
+	return coverageTemplate.Execute(w, files)
+}
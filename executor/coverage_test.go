@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// runCovered runs the given commands from the given lines of pakefile, with the commands of
+// the lines in unreached being reachable but never run, and returns the coverage.
+func runCovered(commands []pakelib.Command, lines []int,
+	unreached map[int]pakelib.Command) *Coverage {
+	logger := log.New(ioutil.Discard, "", 0)
+	coverage := NewCoverage()
+	e := New(logger, WithCoverage(coverage))
+	positions := make([]pakelib.Position, len(lines))
+	for i, line := range lines {
+		positions[i] = pakelib.Position{File: "pakefile", Line: line}
+	}
+	for line, command := range unreached {
+		e.Reachable([]pakelib.Command{command},
+			[]pakelib.Position{{File: "pakefile", Line: line}})
+	}
+	capturer.CaptureOutput(func() {
+		e.RunAt(commands, positions, config.New())
+	})
+	return coverage
+}
+
+func TestWithCoverage(t *testing.T) {
+	coverage := runCovered(
+		[]pakelib.Command{&pakelib.Comment{}, &hello{}, &byeError{}, &hello{}},
+		[]int{1, 2, 3, 2},
+		map[int]pakelib.Command{5: &bye{}},
+	)
+
+	expectedLines := []LineCoverage{{Line: 2, Count: 2}, {Line: 3, Count: 1}, {Line: 5, Count: 0}}
+	if !reflect.DeepEqual(coverage.Lines("pakefile"), expectedLines) {
+		t.Errorf("Expected %+v but got %+v", expectedLines, coverage.Lines("pakefile"))
+	}
+	if percent := coverage.Percent("pakefile"); percent < 66.6 || percent > 66.7 {
+		t.Errorf("Expected 66.7 but got %f", percent)
+	}
+}
+
+func TestCoverage_WriteProfile(t *testing.T) {
+	coverage := runCovered([]pakelib.Command{&hello{}}, []int{1},
+		map[int]pakelib.Command{2: &bye{}})
+
+	var buf bytes.Buffer
+	if err := coverage.WriteProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expectedProfile := "mode: count\npakefile:1 1\npakefile:2 0\n"
+	if buf.String() != expectedProfile {
+		t.Errorf("Expected %s but got %s", expectedProfile, buf.String())
+	}
+}
+
+func TestCoverage_LoadProfile(t *testing.T) {
+	coverage := runCovered([]pakelib.Command{&hello{}}, []int{1},
+		map[int]pakelib.Command{2: &bye{}})
+
+	err := coverage.LoadProfile(strings.NewReader("mode: count\npakefile:1 1\npakefile:2 3\n" +
+		"other pakefile:4 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedLines := []LineCoverage{{Line: 1, Count: 2}, {Line: 2, Count: 3}}
+	if !reflect.DeepEqual(coverage.Lines("pakefile"), expectedLines) {
+		t.Errorf("Expected %+v but got %+v", expectedLines, coverage.Lines("pakefile"))
+	}
+	expectedFiles := []string{"other pakefile", "pakefile"}
+	if !reflect.DeepEqual(coverage.Files(), expectedFiles) {
+		t.Errorf("Expected %+q but got %+q", expectedFiles, coverage.Files())
+	}
+}
+
+func TestCoverage_LoadProfilewitherror(t *testing.T) {
+	coverage := NewCoverage()
+
+	err := coverage.LoadProfile(strings.NewReader("mode: count\npakefile:1 1\npakefile:x 3\n"))
+	if err == nil {
+		t.Fatal("There should be an error loading the given profile!")
+	}
+	expectedErr := `An error occured on line 3: Can't use "x" as a line number`
+	if err.Error() != expectedErr {
+		t.Errorf("Expected %s but got %s", expectedErr, err.Error())
+	}
+	if len(coverage.Files()) != 0 {
+		t.Errorf("Expected nothing to be loaded but got %+q", coverage.Files())
+	}
+}
+
+func TestCoverage_Merge(t *testing.T) {
+	first := runCovered([]pakelib.Command{&hello{}}, []int{1},
+		map[int]pakelib.Command{2: &bye{}})
+	second := runCovered([]pakelib.Command{&bye{}}, []int{2},
+		map[int]pakelib.Command{1: &hello{}})
+
+	first.Merge(second)
+	expectedLines := []LineCoverage{{Line: 1, Count: 1}, {Line: 2, Count: 1}}
+	if !reflect.DeepEqual(first.Lines("pakefile"), expectedLines) {
+		t.Errorf("Expected %+v but got %+v", expectedLines, first.Lines("pakefile"))
+	}
+}
+
+func TestCoverage_WriteHTML(t *testing.T) {
+	coverage := runCovered([]pakelib.Command{&pakelib.Comment{}, &hello{}}, []int{1, 2},
+		map[int]pakelib.Command{3: &bye{}})
+	fsys := fstest.MapFS{
+		"pakefile": &fstest.MapFile{Data: []byte("# greet\nhello <world>\nbye\n")},
+	}
+
+	var buf bytes.Buffer
+	if err := coverage.WriteHTML(&buf, fsys); err != nil {
+		t.Fatal(err)
+	}
+	report := buf.String()
+	for _, expected := range []string{
+		"<h2>pakefile (50.0%)</h2>",
+		`<tr class=""><td class="number">1</td><td class="count"></td><td><pre># greet</pre>`,
+		`<tr class="covered"><td class="number">2</td><td class="count">1</td>` +
+			`<td><pre>hello &lt;world&gt;</pre>`,
+		`<tr class="uncovered"><td class="number">3</td><td class="count">0</td>`,
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Expected the report to contain %s but got %s", expected, report)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package executor
+
+import pakelib "github.com/pake-go/pake-lib"
+
+// WithEnv passes the given Env to every command that satisfies pakelib.EnvCommand, instead of
+// an Env backed by the process's streams, environment, working directory, filesystem and
+// clock.  Fields of the Env that are nil or empty are taken from pakelib.DefaultEnv() without
+// changing the given Env, and FS is backed by Dir if only Dir is given.  With
+// WithConcurrency, the Env is shared by the commands executed at the same time, so its
+// writers and services should be safe for concurrent use.
+func WithEnv(env *pakelib.Env) Option {
+	return func(e *Executor) {
+		e.env = env
+	}
+}
+
+// envFor returns the Env passed to the given command, or nil if it does not satisfy
+// pakelib.EnvCommand.  The Env is completed with pakelib.DefaultEnv() the first time a command
+// needs it, so the process's environment is only read if a command uses it.
+func (e *Executor) envFor(command pakelib.Command) *pakelib.Env {
+	if _, ok := command.(pakelib.EnvCommand); !ok {
+		return nil
+	}
+	e.envOnce.Do(func() {
+		e.env = completeEnv(e.env)
+	})
+	return e.env
+}
+
+// completeEnv returns a copy of the given Env whose nil or empty fields are taken from
+// pakelib.DefaultEnv(), or pakelib.DefaultEnv() itself if env is nil.
+func completeEnv(env *pakelib.Env) *pakelib.Env {
+	defaults := pakelib.DefaultEnv()
+	if env == nil {
+		return defaults
+	}
+	complete := *env
+	if complete.Stdin == nil {
+		complete.Stdin = defaults.Stdin
+	}
+	if complete.Stdout == nil {
+		complete.Stdout = defaults.Stdout
+	}
+	if complete.Stderr == nil {
+		complete.Stderr = defaults.Stderr
+	}
+	if complete.Environ == nil {
+		complete.Environ = defaults.Environ
+	}
+	if complete.FS == nil && complete.Dir != "" {
+		complete.FS = pakelib.OSFileSystem(complete.Dir)
+	}
+	if complete.Dir == "" {
+		complete.Dir = defaults.Dir
+	}
+	if complete.FS == nil {
+		complete.FS = defaults.FS
+	}
+	if complete.Clock == nil {
+		complete.Clock = defaults.Clock
+	}
+	if complete.Services == nil {
+		complete.Services = defaults.Services
+	}
+	return &complete
+}
@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+	"github.com/pake-go/pake-lib/envtest"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+type stamp struct{}
+
+func (s *stamp) Execute(cfg *config.Config, logger *log.Logger) error {
+	return fmt.Errorf("Expected ExecuteEnv to be called")
+}
+
+func (s *stamp) ExecuteEnv(env *pakelib.Env, cfg *config.Config, logger *log.Logger) error {
+	name, err := ioutil.ReadAll(env.Stdin)
+	if err != nil {
+		return err
+	}
+	greeting, ok := env.Service("greeting")
+	if !ok {
+		return fmt.Errorf("Can't find service greeting")
+	}
+	content := fmt.Sprintf("%s %s from %s at %s", greeting, name, env.Getenv("USER"), env.Dir)
+	if err := env.FS.WriteFile("stamp", []byte(content), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stdout, env.Clock.Now().Format(time.RFC3339))
+	return nil
+}
+
+func TestWithEnv(t *testing.T) {
+	fsys := envtest.NewMemoryFileSystem(nil)
+	var stdout bytes.Buffer
+	env := &pakelib.Env{
+		Stdin:    strings.NewReader("pake"),
+		Stdout:   &stdout,
+		Stderr:   ioutil.Discard,
+		Environ:  map[string]string{"USER": "gopher"},
+		Dir:      "/work",
+		FS:       fsys,
+		Clock:    &fakeClock{now: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		Services: map[string]interface{}{"greeting": "Hello"},
+	}
+	logger := log.New(ioutil.Discard, "", 0)
+	var errs []error
+
+	New(logger, WithEnv(env), WithOnError(func(inv *Invocation, err error) {
+		errs = append(errs, err)
+	})).Run([]pakelib.Command{&stamp{}}, config.New())
+
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors but got %+v", errs)
+	}
+	content, err := fs.ReadFile(fsys, "stamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedContent := "Hello pake from gopher at /work"
+	if string(content) != expectedContent {
+		t.Errorf("Expected %s but got %s", expectedContent, content)
+	}
+	expectedStdout := "2020-01-02T03:04:05Z\n"
+	if stdout.String() != expectedStdout {
+		t.Errorf("Expected %s but got %s", expectedStdout, stdout.String())
+	}
+}
+
+// A getenv writes the value of an environment variable to the Env's stdout.
+type getenv struct {
+	key string
+}
+
+func (g *getenv) Execute(cfg *config.Config, logger *log.Logger) error {
+	return fmt.Errorf("Expected ExecuteEnv to be called")
+}
+
+func (g *getenv) ExecuteEnv(env *pakelib.Env, cfg *config.Config, logger *log.Logger) error {
+	_, err := fmt.Fprintln(env.Stdout, env.Getenv(g.key))
+	return err
+}
+
+func TestWithEnv_invocation(t *testing.T) {
+	var stdout bytes.Buffer
+	env := &pakelib.Env{Stdout: &stdout}
+	logger := log.New(ioutil.Discard, "", 0)
+	var mu sync.Mutex
+	var envs []*pakelib.Env
+
+	capturer.CaptureOutput(func() {
+		New(logger, WithEnv(env), WithConcurrency(2), WithBeforeCommand(func(inv *Invocation) {
+			mu.Lock()
+			defer mu.Unlock()
+			envs = append(envs, inv.Env)
+		})).Run([]pakelib.Command{&getenv{"HOME"}, &hello{}, &getenv{"HOME"}}, config.New())
+	})
+
+	if len(envs) != 3 || envs[0] == nil || envs[1] != nil || envs[2] != envs[0] {
+		t.Fatalf("Expected the Env commands to share an Env but got %+v", envs)
+	}
+	if envs[0].Stdout != &stdout || envs[0].Stdin == nil || envs[0].FS == nil ||
+		envs[0].Clock == nil || envs[0].Dir == "" {
+		t.Errorf("Expected the Env to be completed but got %+v", envs[0])
+	}
+	if env.Stdin != nil || env.Clock != nil {
+		t.Errorf("Expected the given Env to not be changed but got %+v", env)
+	}
+	expectedStdout := strings.Repeat(os.Getenv("HOME")+"\n", 2)
+	if stdout.String() != expectedStdout {
+		t.Errorf("Expected %s but got %s", expectedStdout, stdout.String())
+	}
+}
+
+func TestNew_defaultenv(t *testing.T) {
+	var got *pakelib.Env
+	logger := log.New(ioutil.Discard, "", 0)
+	e := New(logger, WithBeforeCommand(func(inv *Invocation) {
+		got = inv.Env
+	}))
+
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{&hello{}}, config.New())
+	})
+	if got != nil || e.env != nil {
+		t.Errorf("Expected no Env to be created without Env commands but got %+v", got)
+	}
+
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{&getenv{"HOME"}}, config.New())
+	})
+	if got == nil {
+		t.Fatal("Expected the invocation to have an Env")
+	}
+	if got.Stdout == nil || got.FS == nil || got.Clock == nil {
+		t.Errorf("Expected the default Env to be complete but got %+v", got)
+	}
+}
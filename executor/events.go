@@ -0,0 +1,252 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// EventSchemaVersion is the version of the schema of the events written by WithEventStream.
+// It is written in every event and only changes when a field is removed or changes meaning;
+// new fields and event types may be added without changing it, so readers should ignore what
+// they do not know.
+const EventSchemaVersion = 1
+
+// EventType represents what an event describes.
+type EventType string
+
+const (
+	// RunStarted is written when Run or RunAt is called, with the number of commands.  It is
+	// written for every call, so target.Graph.Run, which calls RunAt for the commands outside
+	// of any target and then for each target, writes a RunStarted and RunFinished pair for
+	// each of them.
+	RunStarted EventType = "run_started"
+	// CommandStarted is written before a command is executed, with its position and type.
+	CommandStarted EventType = "command_started"
+	// CommandFinished is written after a command succeeded, with its position, type and
+	// duration.
+	CommandFinished EventType = "command_finished"
+	// CommandFailed is written after a command failed, with its position, type, duration
+	// and error.
+	CommandFailed EventType = "command_failed"
+	// CommandSkipped is written instead of CommandStarted when a command is skipped because
+	// its outputs are up to date, with its position and the reason.  It is also written after
+	// CommandStarted, with the reason "terminated", for a command that was not executed
+	// because the script was terminated.
+	CommandSkipped EventType = "command_skipped"
+	// ConfigChanged is written when the value of a key of the Config changes, with the key,
+	// its old and new values, the cause of the change and its source.
+	ConfigChanged EventType = "config_changed"
+	// RunFinished is written once Run or RunAt has executed every command, with the number
+	// of commands and of failures.
+	RunFinished EventType = "run_finished"
+)
+
+// An Event is a line of the stream written by WithEventStream.  Every event has a version,
+// a type and a time.  The other fields are written for the types of events listed in their
+// documentation, even if they are empty or zero, and are omitted from every other event,
+// except for File which is omitted whenever the name of the script is not known.
+type Event struct {
+	// Version is EventSchemaVersion.
+	Version int `json:"version"`
+	// Type is what the event describes.
+	Type EventType `json:"type"`
+	// Time is when the event happened.
+	Time time.Time `json:"time"`
+	// File is the name of the script the command is in, for the same events as Line.
+	File string `json:"file,omitempty"`
+	// Line is the line of the command, for CommandStarted, CommandFinished, CommandFailed
+	// and CommandSkipped events.
+	Line int `json:"line"`
+	// Command is the type of the command, for CommandStarted, CommandFinished and
+	// CommandFailed events.
+	Command string `json:"command"`
+	// DurationMS is how long the command took in milliseconds, for CommandFinished and
+	// CommandFailed events.
+	DurationMS float64 `json:"duration_ms"`
+	// Error is the error returned by the command, for CommandFailed events.
+	Error string `json:"error"`
+	// Reason explains why the command was skipped, for CommandSkipped events.
+	Reason string `json:"reason"`
+	// Key is the key of the Config that changed, for ConfigChanged events.
+	Key string `json:"key"`
+	// Old is the value of the key before the change, or an empty string if it had none, for
+	// ConfigChanged events.
+	Old string `json:"old"`
+	// New is the value of the key after the change, or an empty string if it has none, for
+	// ConfigChanged events.
+	New string `json:"new"`
+	// Cause is the reason the value of the key changed, as returned by config.Cause.String,
+	// for ConfigChanged events.
+	Cause string `json:"cause"`
+	// Source is the position of the command that changed the key, or an empty string if it
+	// is not known, for ConfigChanged events.
+	Source string `json:"source"`
+	// Commands is the number of commands given to Run or RunAt, for RunStarted and
+	// RunFinished events.
+	Commands int `json:"commands"`
+	// Failures is the number of commands that failed, for RunFinished events.
+	Failures int `json:"failures"`
+}
+
+// MarshalJSON encodes the event with the fields written for its type.
+func (ev Event) MarshalJSON() ([]byte, error) {
+	encoded := struct {
+		Version    int       `json:"version"`
+		Type       EventType `json:"type"`
+		Time       time.Time `json:"time"`
+		File       string    `json:"file,omitempty"`
+		Line       *int      `json:"line,omitempty"`
+		Command    *string   `json:"command,omitempty"`
+		DurationMS *float64  `json:"duration_ms,omitempty"`
+		Error      *string   `json:"error,omitempty"`
+		Reason     *string   `json:"reason,omitempty"`
+		Key        *string   `json:"key,omitempty"`
+		Old        *string   `json:"old,omitempty"`
+		New        *string   `json:"new,omitempty"`
+		Cause      *string   `json:"cause,omitempty"`
+		Source     *string   `json:"source,omitempty"`
+		Commands   *int      `json:"commands,omitempty"`
+		Failures   *int      `json:"failures,omitempty"`
+	}{Version: ev.Version, Type: ev.Type, Time: ev.Time}
+	switch ev.Type {
+	case RunStarted:
+		encoded.Commands = &ev.Commands
+	case CommandStarted, CommandFinished, CommandFailed:
+		encoded.File, encoded.Line, encoded.Command = ev.File, &ev.Line, &ev.Command
+		if ev.Type != CommandStarted {
+			encoded.DurationMS = &ev.DurationMS
+		}
+		if ev.Type == CommandFailed {
+			encoded.Error = &ev.Error
+		}
+	case CommandSkipped:
+		encoded.File, encoded.Line, encoded.Reason = ev.File, &ev.Line, &ev.Reason
+	case ConfigChanged:
+		encoded.Key, encoded.Old, encoded.New = &ev.Key, &ev.Old, &ev.New
+		encoded.Cause, encoded.Source = &ev.Cause, &ev.Source
+	case RunFinished:
+		encoded.Commands, encoded.Failures = &ev.Commands, &ev.Failures
+	}
+	return json.Marshal(encoded)
+}
+
+// An eventStream writes events as newline-delimited JSON.
+type eventStream struct {
+	// Guards w and failures.
+	mu sync.Mutex
+	// Represents the writer the events are written to.
+	w io.Writer
+	// Represents the number of commands that failed since the run started.
+	failures int
+}
+
+// WithEventStream writes an Event to w for every run, command and change to the Config as
+// newline-delimited JSON, so that runs can be followed by programs such as CI systems and web
+// interfaces.  Each line is a JSON object whose "version" field is EventSchemaVersion and
+// whose "type" field is one of the EventType values.  Errors are still reported as usual, and
+// events that can't be written are reported to the logger.
+// With WithConcurrency, the events of commands executed at the same time are written once
+// they have all finished, in the order of the commands.
+func WithEventStream(w io.Writer) Option {
+	return func(e *Executor) {
+		e.events = &eventStream{w: w}
+	}
+}
+
+// emit writes the given event with the schema version and the current time.
+func (s *eventStream) emit(event Event) error {
+	event.Version = EventSchemaVersion
+	event.Time = time.Now()
+	content, err := json.Marshal(event)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.Type == CommandFailed {
+		s.failures++
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(content, '\n'))
+	return err
+}
+
+// emit writes the given event to the event stream and writes the error to the logger if it
+// can't be written.
+func (e *Executor) emit(event Event) {
+	if err := e.events.emit(event); err != nil {
+		e.logger.Printf("Can't write the %s event: %s", event.Type, err.Error())
+	}
+}
+
+// startRun writes a RunStarted event and a ConfigChanged event for every change made to the
+// Config until the returned function is called, which writes a RunFinished event.
+func (e *Executor) startRun(n int, cfg *config.Config) func() {
+	if e.events == nil {
+		return func() {}
+	}
+	e.events.mu.Lock()
+	failures := e.events.failures
+	e.events.mu.Unlock()
+	e.emit(Event{Type: RunStarted, Commands: n})
+	unsubscribe := cfg.Subscribe(func(change config.Change) {
+		e.emit(Event{
+			Type:   ConfigChanged,
+			Key:    change.Key,
+			Old:    change.Old,
+			New:    change.New,
+			Cause:  change.Cause.String(),
+			Source: change.Source,
+		})
+	})
+	return func() {
+		unsubscribe()
+		e.events.mu.Lock()
+		failures = e.events.failures - failures
+		e.events.mu.Unlock()
+		e.emit(Event{Type: RunFinished, Commands: n, Failures: failures})
+	}
+}
+
+// emitCommand writes an event of the given type for the command at the given position.
+func (e *Executor) emitCommand(eventType EventType, pos pakelib.Position,
+	command pakelib.Command) {
+	if e.events == nil {
+		return
+	}
+	e.emit(Event{Type: eventType, File: pos.File, Line: pos.Line,
+		Command: fmt.Sprintf("%T", command)})
+}
+
+// emitResult writes a CommandFinished or CommandFailed event for the command of the given
+// invocation.
+func (e *Executor) emitResult(inv *Invocation, err error) {
+	if e.events == nil {
+		return
+	}
+	event := Event{
+		Type:       CommandFinished,
+		File:       inv.Position.File,
+		Line:       inv.Position.Line,
+		Command:    fmt.Sprintf("%T", inv.Command),
+		DurationMS: float64(inv.Duration) / float64(time.Millisecond),
+	}
+	if err != nil {
+		event.Type = CommandFailed
+		event.Error = err.Error()
+	}
+	e.emit(event)
+}
+
+// emitSkip writes a CommandSkipped event for the command at the given position.
+func (e *Executor) emitSkip(pos pakelib.Position, reason string) {
+	if e.events == nil {
+		return
+	}
+	e.emit(Event{Type: CommandSkipped, File: pos.File, Line: pos.Line, Reason: reason})
+}
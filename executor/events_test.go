@@ -0,0 +1,156 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// decodeEvents decodes the events written to the given buffer, clearing their times and
+// durations.
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []Event {
+	var events []Event
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Time.IsZero() {
+			t.Errorf("Expected the event %+v to have a time", event)
+		}
+		event.Time = time.Time{}
+		event.DurationMS = 0
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestWithEventStream(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var buf bytes.Buffer
+
+	capturer.CaptureOutput(func() {
+		New(logger, WithEventStream(&buf), WithFilename("pakefile")).Run(
+			[]pakelib.Command{&setVerbose{}, &byeError{}}, config.New())
+	})
+
+	expectedEvents := []Event{
+		{Version: 1, Type: RunStarted, Commands: 2},
+		{Version: 1, Type: CommandStarted, File: "pakefile", Line: 1,
+			Command: "*executor.setVerbose"},
+		{Version: 1, Type: ConfigChanged, Key: "verbose", New: "true", Cause: "temporary",
+			Source: "pakefile:1"},
+		{Version: 1, Type: CommandFinished, File: "pakefile", Line: 1,
+			Command: "*executor.setVerbose"},
+		{Version: 1, Type: CommandStarted, File: "pakefile", Line: 2,
+			Command: "*executor.byeError"},
+		{Version: 1, Type: CommandFailed, File: "pakefile", Line: 2,
+			Command: "*executor.byeError", Error: "Error from bye"},
+		{Version: 1, Type: ConfigChanged, Key: "verbose", Old: "true", Cause: "expiry",
+			Source: "pakefile:2"},
+		{Version: 1, Type: RunFinished, Commands: 2, Failures: 1},
+	}
+	if events := decodeEvents(t, &buf); !reflect.DeepEqual(events, expectedEvents) {
+		t.Errorf("Expected %+v but got %+v", expectedEvents, events)
+	}
+}
+
+type lockedResource struct {
+	name string
+}
+
+func (lr *lockedResource) Execute(cfg *config.Config, logger *log.Logger) error {
+	return fmt.Errorf("Error from %s", lr.name)
+}
+
+func (lr *lockedResource) Resources() []string {
+	return []string{lr.name}
+}
+
+func TestWithEventStream_parallelorder(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var buf bytes.Buffer
+
+	capturer.CaptureOutput(func() {
+		New(logger, WithEventStream(&buf), WithConcurrency(4)).Run([]pakelib.Command{
+			&lockedResource{"a"}, &lockedResource{"b"}, &lockedResource{"c"},
+		}, config.New())
+	})
+
+	var types []string
+	for _, event := range decodeEvents(t, &buf) {
+		types = append(types, fmt.Sprintf("%s %d", event.Type, event.Line))
+	}
+	expectedTypes := []string{"run_started 0",
+		"command_started 1", "command_failed 1",
+		"command_started 2", "command_failed 2",
+		"command_started 3", "command_failed 3",
+		"run_finished 0"}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Errorf("Expected %+q but got %+q", expectedTypes, types)
+	}
+}
+
+func TestWithEventStream_requiredfields(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var buf bytes.Buffer
+
+	New(logger, WithEventStream(&buf)).Run([]pakelib.Command{&setVerbose{}}, config.New())
+
+	var fields []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		event := make(map[string]interface{})
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		delete(event, "version")
+		delete(event, "time")
+		if _, ok := event["duration_ms"]; ok {
+			event["duration_ms"] = 0
+		}
+		fields = append(fields, fmt.Sprint(event))
+	}
+	expectedFields := []string{
+		"map[commands:1 type:run_started]",
+		"map[command:*executor.setVerbose line:1 type:command_started]",
+		"map[cause:temporary key:verbose new:true old: source:line 1 type:config_changed]",
+		"map[command:*executor.setVerbose duration_ms:0 line:1 type:command_finished]",
+		"map[commands:1 failures:0 type:run_finished]",
+	}
+	if !reflect.DeepEqual(fields, expectedFields) {
+		t.Errorf("Expected %+q but got %+q", expectedFields, fields)
+	}
+}
+
+// A brokenWriter fails every write.
+type brokenWriter struct {
+}
+
+func (bw *brokenWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("Broken writer")
+}
+
+func TestWithEventStream_writeerror(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+
+	New(logger, WithEventStream(&brokenWriter{})).Run([]pakelib.Command{}, config.New())
+
+	expectedLogOutput := "Can't write the run_started event: Broken writer\n" +
+		"Can't write the run_finished event: Broken writer\n"
+	if logOutput.String() != expectedLogOutput {
+		t.Errorf("Expected %s but got %s", expectedLogOutput, logOutput.String())
+	}
+}
@@ -2,8 +2,13 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/PGo-Projects/output"
 	pakelib "github.com/pake-go/pake-lib"
@@ -13,14 +18,255 @@ import (
 // Run iterates through the list of commands passed to it and calls the Execute() function for
 // each of them.
 func Run(commands []pakelib.Command, logger *log.Logger) {
-	cfg := config.New()
-	for line, command := range commands {
-		err := command.Execute(cfg, logger)
-		if err != nil {
-			errMsg := fmt.Errorf("There was an error at line %d: %s", line+1, err.Error())
-			logger.Println(errMsg.Error())
-			output.Error(errMsg)
+	RunWithConfig(commands, config.New(), logger)
+}
+
+// RunWithConfig is the same as Run but executes the commands with the given Config, allowing
+// the caller to seed it beforehand and to subscribe to its changes.  Changes made by each
+// command are recorded with the position of the command, "line N", as their source.
+func RunWithConfig(commands []pakelib.Command, cfg *config.Config, logger *log.Logger) {
+	New(logger).Run(commands, cfg)
+}
+
+// Executor executes the commands returned by the parser.  An Executor executes commands one
+// at a time unless it is given options that change its behavior.
+type Executor struct {
+	// Represents the logger errors are written to and that is passed to every command.
+	logger *log.Logger
+	// Represents how many commands may be executed at the same time.
+	concurrency int
+	// Represents the name of the script the commands given to Run were parsed from.
+	filename string
+	// Represents whether commands whose outputs are up to date are skipped.
+	incremental bool
+	// Represents the directory the content hashes of up to date commands are stored in.
+	cacheDir string
+	// Represents whether commands are executed even if their outputs are up to date.
+	force bool
+	// Represents the commands that were skipped because their outputs were up to date.
+	skipped []Skip
+	// Represents the blocks that have been started but not ended, outermost first.
+	stack []Frame
+	// Guards skipped, stack, checkpointed, lastSuccessful and rollbacks.
+	mu sync.Mutex
+	// Represents the middleware wrapping the execution of every command, outermost first.
+	middleware []Middleware
+	// Represents the execution of a command wrapped by every middleware.
+	chain Handler
+	// Represents the functions called before every command is executed.
+	beforeCommand []func(*Invocation)
+	// Represents the functions called after every command is executed.
+	afterCommand []func(*Invocation, error)
+	// Represents the functions called with every error instead of the default rendering.
+	onError []func(*Invocation, error)
+	// Represents the retry policy for commands without a policy for their type.
+	retryPolicy *RetryPolicy
+	// Represents the retry policies keyed by the type of command.
+	retryPolicies map[reflect.Type]RetryPolicy
+	// Represents the function used to wait before retrying a command.
+	sleep func(time.Duration)
+	// Represents the structured logger every command is recorded to.
+	structuredLogger *slog.Logger
+	// Represents the tracer every command is recorded to.
+	tracer *Tracer
+	// Represents the profile every command is recorded to.
+	profile *Profile
+	// Represents the coverage every command is recorded to.
+	coverage *Coverage
+	// Represents the file checkpoints are written to.
+	checkpointFile string
+	// Represents the hash of the script recorded in checkpoints.
+	scriptHash string
+	// Represents whether a checkpoint has been written.
+	checkpointed bool
+	// Represents the position of the last command that succeeded.
+	lastSuccessful pakelib.Position
+	// Represents whether the commands given to each call of RunAt are a transaction.
+	transaction bool
+	// Represents the transaction started by Begin, or nil if there is none.
+	tx *transaction
+	// Represents the rollbacks made so far.
+	rollbacks []Rollback
+	// Represents the stream events are written to.
+	events *eventStream
+	// Represents the Env passed to commands that satisfy pakelib.EnvCommand.
+	env *pakelib.Env
+	// Guards the completion of env the first time a command needs it.
+	envOnce sync.Once
+}
+
+// An Option changes the behavior of an Executor.
+type Option func(*Executor)
+
+// New returns an Executor that writes errors to the given logger and passes it to every
+// command, with its behavior changed by the given options.  The logger may only be nil if
+// WithStructuredLogger is given.
+func New(logger *log.Logger, opts ...Option) *Executor {
+	e := &Executor{
+		logger:      logger,
+		concurrency: 1,
+		sleep:       time.Sleep,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.logger == nil && e.structuredLogger != nil {
+		e.logger = slog.NewLogLogger(e.structuredLogger.Handler(), slog.LevelInfo)
+	}
+	e.chain = e.handler()
+	return e
+}
+
+// WithFilename sets the name of the script the commands given to Run were parsed from, so
+// that errors and positions name the script.
+func WithFilename(filename string) Option {
+	return func(e *Executor) {
+		e.filename = filename
+	}
+}
+
+// Run iterates through the list of commands passed to it and calls the Execute() function for
+// each of them with the given Config.  The commands are expected to be one per line, as
+// returned by the parser.  Errors are reported with the line of the command and do not stop
+// the remaining commands from being executed unless WithCheckpoint or WithTransaction is
+// given.  It returns a *CommandError for the first command that failed, if any.
+func (e *Executor) Run(commands []pakelib.Command, cfg *config.Config) error {
+	return e.RunAt(commands, pakelib.Positions(e.filename, len(commands)), cfg)
+}
+
+// RunAt is the same as Run but reports the given position for each command instead of
+// assuming one command per line.  It returns an error without executing anything if there
+// are fewer positions than commands, and stops and returns ErrTerminated once a command was
+// terminated.
+func (e *Executor) RunAt(commands []pakelib.Command, positions []pakelib.Position,
+	cfg *config.Config) error {
+	if len(positions) < len(commands) {
+		return fmt.Errorf("Expected a position for each of the %d commands but got %d",
+			len(commands), len(positions))
+	}
+	e.Reachable(commands, positions)
+	defer e.startRun(len(commands), cfg)()
+	var err error
+	if e.transaction {
+		err = e.runTransaction(commands, positions, cfg)
+	} else if e.concurrency > 1 {
+		err = e.runParallel(commands, positions, cfg)
+	} else {
+		for i, command := range commands {
+			_, commandErr := e.execute(positions[i], command, cfg)
+			if errors.Is(commandErr, ErrTerminated) {
+				return ErrTerminated
+			}
+			if err == nil {
+				err = failure(positions[i], commandErr)
+			}
+			if err != nil && e.stopsAtFailure() {
+				break
+			}
+		}
+	}
+	if errors.Is(err, ErrTerminated) {
+		return err
+	}
+	e.removeCheckpoint()
+	return err
+}
+
+// A CommandError is the error returned by Run and RunAt when a command fails.
+type CommandError struct {
+	// Position is the position of the command that failed.
+	Position pakelib.Position
+	// Err is the error returned by the command.
+	Err error
+}
+
+// Error returns a description of the error naming the position of the command.
+func (ce *CommandError) Error() string {
+	if ce.Position.File == "" {
+		return fmt.Sprintf("There was an error at line %d: %s", ce.Position.Line, ce.Err.Error())
+	}
+	return fmt.Sprintf("There was an error in %s at line %d: %s", ce.Position.File,
+		ce.Position.Line, ce.Err.Error())
+}
+
+// Unwrap returns the error returned by the command.
+func (ce *CommandError) Unwrap() error {
+	return ce.Err
+}
+
+// failure returns a *CommandError for the command at the given position if err is not nil,
+// or nil otherwise.  ErrTerminated is returned as is.
+func failure(pos pakelib.Position, err error) error {
+	if err == nil || errors.Is(err, ErrTerminated) {
+		return err
+	}
+	return &CommandError{Position: pos, Err: err}
+}
+
+// terminatedReason is the reason written to the event stream for commands that were not
+// executed because the script was terminated.
+const terminatedReason = "terminated"
+
+// execute executes the command at the given position, reports its error and ages the
+// temporary values of the Config.  It returns the invocation of the command, or nil if the
+// command was skipped, along with the error of the command.
+func (e *Executor) execute(pos pakelib.Position, command pakelib.Command,
+	cfg *config.Config) (*Invocation, error) {
+	cfg.SetSource(pos.String())
+	defer cfg.SmartReset()
+	if reason, ok := e.upToDate(command); ok {
+		e.skip(pos, reason)
+		e.checkpoint(pos, config.State{}, nil)
+		return nil, nil
+	}
+	state := e.stateFor(cfg)
+	e.emitCommand(CommandStarted, pos, command)
+	inv := e.newInvocation(pos, command, cfg, e.logger, e.CallStack())
+	err := e.invoke(inv)
+	if errors.Is(err, ErrTerminated) {
+		e.emitSkip(pos, terminatedReason)
+		return inv, err
+	}
+	e.checkpoint(pos, state, err)
+	e.report(inv, err)
+	return inv, err
+}
+
+// newInvocation returns the invocation of the command at the given position, executed with the
+// given Config and logger in the given blocks.
+func (e *Executor) newInvocation(pos pakelib.Position, command pakelib.Command,
+	cfg *config.Config, logger *log.Logger, stack []Frame) *Invocation {
+	return &Invocation{
+		Command:          command,
+		Position:         pos,
+		Config:           cfg,
+		Logger:           logger,
+		StructuredLogger: e.structuredLogger,
+		Env:              e.envFor(command),
+		Stack:            stack,
+	}
+}
+
+// report writes how the command of the given invocation finished to the structured logger and
+// the event stream and passes its error, if any, to the functions given to WithOnError, or
+// writes it to the logger and to the output if there are none and no structured logger was
+// given.
+func (e *Executor) report(inv *Invocation, err error) {
+	e.logResult(inv, err)
+	e.emitResult(inv, err)
+	if err == nil {
+		return
+	}
+	if len(e.onError) != 0 {
+		for _, fn := range e.onError {
+			fn(inv, err)
 		}
-		cfg.SmartReset()
+		return
+	}
+	if e.structuredLogger != nil {
+		return
 	}
+	errMsg := &CommandError{Position: inv.Position, Err: err}
+	e.logger.Println(errMsg.Error())
+	output.Error(errMsg)
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"testing"
 
@@ -48,6 +49,84 @@ func TestRun_expectederror(t *testing.T) {
 	}
 }
 
+func TestRunAt_withfilename(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	positions := []pakelib.Position{
+		{File: "pakefile", Line: 3},
+		{File: "pakefile", Line: 7},
+	}
+
+	capturer.CaptureOutput(func() {
+		New(logger).RunAt([]pakelib.Command{&hello{}, &byeError{}}, positions, config.New())
+	})
+
+	expectedLogOutput := "There was an error in pakefile at line 7: Error from bye\n"
+	if logOutput.String() != expectedLogOutput {
+		t.Errorf("Expected %s but got %s", expectedLogOutput, logOutput.String())
+	}
+}
+
+func TestRunAt_returnsfirsterror(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	positions := []pakelib.Position{{Line: 1}, {Line: 2}, {Line: 3}}
+	for _, opts := range [][]Option{nil, {WithConcurrency(2)}, {WithTransaction()}} {
+		var err error
+		capturer.CaptureOutput(func() {
+			err = New(logger, opts...).RunAt(
+				[]pakelib.Command{&byeError{}, &hello{}, &byeError{}}, positions, config.New())
+		})
+
+		var commandErr *CommandError
+		if !errors.As(err, &commandErr) || commandErr.Position.Line != 1 {
+			t.Errorf("Expected a *CommandError at line 1 but got %+v", err)
+		}
+		expectedErr := "There was an error at line 1: Error from bye"
+		if err == nil || err.Error() != expectedErr {
+			t.Errorf("Expected %s but got %v", expectedErr, err)
+		}
+	}
+}
+
+func TestRunAt_missingpositions(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+
+	var err error
+	output := capturer.CaptureOutput(func() {
+		err = New(logger).RunAt([]pakelib.Command{&hello{}, &bye{}},
+			[]pakelib.Position{{Line: 1}}, config.New())
+	})
+
+	expectedErr := "Expected a position for each of the 2 commands but got 1"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("Expected %s but got %v", expectedErr, err)
+	}
+	if output != "" {
+		t.Errorf("Expected no command to be executed but got %s", output)
+	}
+}
+
+func TestRunWithConfig_recordssource(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	cfg := config.New()
+	history := config.NewHistory(cfg)
+
+	capturer.CaptureOutput(func() {
+		RunWithConfig([]pakelib.Command{&hello{}, &setVerbose{}, &bye{}, &bye{}}, cfg, logger)
+	})
+
+	changes := history.Changes("verbose")
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes but got %+v", changes)
+	}
+	if changes[0].Source != "line 2" || changes[0].Cause != config.CauseTemporary {
+		t.Errorf("Expected verbose to be set by line 2 but got %+v", changes[0])
+	}
+	if changes[1].Source != "line 3" || changes[1].Cause != config.CauseExpiry {
+		t.Errorf("Expected verbose to expire after line 3 but got %+v", changes[1])
+	}
+}
+
 type hello struct {
 	args []string
 }
@@ -73,3 +152,11 @@ type byeError struct {
 func (be *byeError) Execute(cfg *config.Config, logger *log.Logger) error {
 	return errors.New("Error from bye")
 }
+
+type setVerbose struct {
+	args []string
+}
+
+func (sv *setVerbose) Execute(cfg *config.Config, logger *log.Logger) error {
+	return cfg.SetTemporarily("verbose", "true")
+}
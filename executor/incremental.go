@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	pakelib "github.com/pake-go/pake-lib"
+)
+
+// A Skip describes a command that was skipped because its outputs were up to date.
+type Skip struct {
+	// Position is the position of the command that was skipped.
+	Position pakelib.Position
+	// Reason explains why the outputs of the command were up to date.
+	Reason string
+}
+
+// WithIncremental skips commands that implement pakelib.FileUser when their outputs are up
+// to date.  Outputs are up to date when they are all newer than every input, or, if cacheDir
+// is not empty, when the content hash of the inputs and outputs matches the hash stored in
+// cacheDir the last time the same command with the same arguments succeeded.  Commands that
+// do not declare any inputs or any outputs are never skipped.  Skipped commands still count
+// as executed for SmartReset().
+func WithIncremental(cacheDir string) Option {
+	return func(e *Executor) {
+		e.incremental = true
+		e.cacheDir = cacheDir
+	}
+}
+
+// WithForce executes every command even if its outputs are up to date, while still updating
+// the content hashes stored by WithIncremental.
+func WithForce(force bool) Option {
+	return func(e *Executor) {
+		e.force = force
+	}
+}
+
+// Skipped returns the commands that have been skipped by the executor so far because their
+// outputs were up to date, in the order they were skipped.
+func (e *Executor) Skipped() []Skip {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Skip{}, e.skipped...)
+}
+
+// WriteSkipReport writes a line for each command that has been skipped so far to w.
+func (e *Executor) WriteSkipReport(w io.Writer) error {
+	for _, skip := range e.Skipped() {
+		if _, err := fmt.Fprintf(w, "Skipped %s: %s\n", skip.Position, skip.Reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip records that the command at the given position was skipped.
+func (e *Executor) skip(pos pakelib.Position, reason string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.skipped = append(e.skipped, Skip{Position: pos, Reason: reason})
+	e.logSkip(pos, reason)
+	e.emitSkip(pos, reason)
+}
+
+// upToDate checks to see if the given command can be skipped and returns the reason why.
+func (e *Executor) upToDate(command pakelib.Command) (string, bool) {
+	fileUser, ok := command.(pakelib.FileUser)
+	if !e.incremental || e.force || !ok || !usesFiles(fileUser) {
+		return "", false
+	}
+	if newerOutputs(fileUser.Inputs(), fileUser.Outputs()) {
+		return "outputs are newer than inputs", true
+	}
+	if e.cacheDir == "" {
+		return "", false
+	}
+	stored, err := os.ReadFile(e.cacheFile(command, fileUser))
+	if err != nil {
+		return "", false
+	}
+	hash, err := contentHash(fileUser)
+	if err != nil || hash != string(stored) {
+		return "", false
+	}
+	return "content hash matches cache", true
+}
+
+// finished stores the content hash of the given command if it succeeded.
+func (e *Executor) finished(command pakelib.Command, err error) {
+	fileUser, ok := command.(pakelib.FileUser)
+	if err != nil || !e.incremental || e.cacheDir == "" || !ok || !usesFiles(fileUser) {
+		return
+	}
+	hash, err := contentHash(fileUser)
+	if err != nil {
+		e.logger.Printf("Can't hash the files of %T: %s", command, err.Error())
+		return
+	}
+	if err := os.MkdirAll(e.cacheDir, 0755); err != nil {
+		e.logger.Println(err.Error())
+		return
+	}
+	if err := os.WriteFile(e.cacheFile(command, fileUser), []byte(hash), 0644); err != nil {
+		e.logger.Println(err.Error())
+	}
+}
+
+// usesFiles checks to see if the given command declares both inputs and outputs, which is
+// required for its outputs to ever be up to date.
+func usesFiles(fileUser pakelib.FileUser) bool {
+	return len(fileUser.Inputs()) != 0 && len(fileUser.Outputs()) != 0
+}
+
+// newerOutputs checks to see if every output exists and is at least as new as every input.
+func newerOutputs(inputs, outputs []string) bool {
+	var newestInput int64
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return false
+		}
+		if modTime := info.ModTime().UnixNano(); modTime > newestInput {
+			newestInput = modTime
+		}
+	}
+	for _, output := range outputs {
+		info, err := os.Stat(output)
+		if err != nil || info.ModTime().UnixNano() < newestInput {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheFile returns the name of the file the content hash of the given command is stored in.
+// Only commands of the same type with the same fingerprint, inputs and outputs share a cache
+// file.
+func (e *Executor) cacheFile(command pakelib.Command, fileUser pakelib.FileUser) string {
+	key := sha256.Sum256([]byte(fmt.Sprintf("%T %q %q %q", command, fingerprint(command),
+		fileUser.Inputs(), fileUser.Outputs())))
+	return filepath.Join(e.cacheDir, hex.EncodeToString(key[:]))
+}
+
+// fingerprint returns the fingerprint of the given command, which is the Go syntax
+// representation of its value unless it implements pakelib.Fingerprinter.
+func fingerprint(command pakelib.Command) string {
+	if fingerprinter, ok := command.(pakelib.Fingerprinter); ok {
+		return fingerprinter.Fingerprint()
+	}
+	return fmt.Sprintf("%#v", command)
+}
+
+// contentHash returns the hash of the names and contents of the inputs and outputs of the
+// given command.
+func contentHash(fileUser pakelib.FileUser) (string, error) {
+	h := sha256.New()
+	files := append(append([]string{}, fileUser.Inputs()...), fileUser.Outputs()...)
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%q\n", name)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
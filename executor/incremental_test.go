@@ -0,0 +1,195 @@
+package executor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+func TestRun_incrementalneweroutputs(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(ioutil.Discard, "", 0)
+	cp := &copyFile{in: filepath.Join(dir, "in"), out: filepath.Join(dir, "out")}
+	ioutil.WriteFile(cp.in, []byte("content"), 0644)
+
+	e := New(logger, WithIncremental(""))
+	e.Run([]pakelib.Command{cp}, config.New())
+	e.Run([]pakelib.Command{cp}, config.New())
+	if cp.runs != 1 {
+		t.Errorf("Expected the command to run once but it ran %d times", cp.runs)
+	}
+
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(cp.in, later, later)
+	e.Run([]pakelib.Command{cp}, config.New())
+	if cp.runs != 2 {
+		t.Errorf("Expected the command to run again after its input changed but it ran %d times",
+			cp.runs)
+	}
+
+	expectedSkipped := []Skip{
+		{Position: pakelib.Position{Line: 1}, Reason: "outputs are newer than inputs"},
+	}
+	if len(e.Skipped()) != 1 || e.Skipped()[0] != expectedSkipped[0] {
+		t.Errorf("Expected %+v but got %+v", expectedSkipped, e.Skipped())
+	}
+	var report bytes.Buffer
+	e.WriteSkipReport(&report)
+	expectedReport := "Skipped line 1: outputs are newer than inputs\n"
+	if report.String() != expectedReport {
+		t.Errorf("Expected %s but got %s", expectedReport, report.String())
+	}
+}
+
+func TestRun_incrementalcontenthash(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	logger := log.New(ioutil.Discard, "", 0)
+	cp := &copyFile{in: filepath.Join(dir, "in"), out: filepath.Join(dir, "out")}
+	ioutil.WriteFile(cp.in, []byte("content"), 0644)
+
+	e := New(logger, WithIncremental(cacheDir))
+	e.Run([]pakelib.Command{cp}, config.New())
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(cp.in, later, later)
+	e.Run([]pakelib.Command{cp}, config.New())
+	if cp.runs != 1 {
+		t.Errorf("Expected the command to be skipped when the content did not change but it ran"+
+			" %d times", cp.runs)
+	}
+	if len(e.Skipped()) != 1 || e.Skipped()[0].Reason != "content hash matches cache" {
+		t.Errorf("Expected the content hash to match but got %+v", e.Skipped())
+	}
+
+	ioutil.WriteFile(cp.in, []byte("changed"), 0644)
+	os.Chtimes(cp.in, later, later)
+	e.Run([]pakelib.Command{cp}, config.New())
+	if cp.runs != 2 {
+		t.Errorf("Expected the command to run again after its input changed but it ran %d times",
+			cp.runs)
+	}
+}
+
+func TestRun_incrementalforce(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(ioutil.Discard, "", 0)
+	cp := &copyFile{in: filepath.Join(dir, "in"), out: filepath.Join(dir, "out")}
+	ioutil.WriteFile(cp.in, []byte("content"), 0644)
+
+	e := New(logger, WithIncremental(""), WithForce(true))
+	e.Run([]pakelib.Command{cp, cp}, config.New())
+	if cp.runs != 2 {
+		t.Errorf("Expected the command to run twice but it ran %d times", cp.runs)
+	}
+	if len(e.Skipped()) != 0 {
+		t.Errorf("Expected nothing to be skipped but got %+v", e.Skipped())
+	}
+}
+
+func TestRun_incrementaldisabled(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(ioutil.Discard, "", 0)
+	cp := &copyFile{in: filepath.Join(dir, "in"), out: filepath.Join(dir, "out")}
+	ioutil.WriteFile(cp.in, []byte("content"), 0644)
+
+	New(logger).Run([]pakelib.Command{cp, cp}, config.New())
+	if cp.runs != 2 {
+		t.Errorf("Expected the command to run twice but it ran %d times", cp.runs)
+	}
+}
+
+func TestRun_incrementalarguments(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	logger := log.New(ioutil.Discard, "", 0)
+	in := filepath.Join(dir, "in")
+	out := filepath.Join(dir, "out")
+	ioutil.WriteFile(in, []byte("content"), 0644)
+	runs := 0
+	first := &writeFile{inputs: []string{in}, out: out, content: "first", runs: &runs}
+	second := &writeFile{inputs: []string{in}, out: out, content: "second", runs: &runs}
+
+	e := New(logger, WithIncremental(cacheDir))
+	e.Run([]pakelib.Command{first}, config.New())
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(in, later, later)
+	e.Run([]pakelib.Command{second}, config.New())
+	if runs != 2 {
+		t.Errorf("Expected the command to run again after its arguments changed but it ran %d"+
+			" times", runs)
+	}
+	content, _ := ioutil.ReadFile(out)
+	if string(content) != "second" {
+		t.Errorf("Expected %s but got %s", "second", content)
+	}
+}
+
+func TestRun_incrementalnoinputs(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(ioutil.Discard, "", 0)
+	runs := 0
+	w := &writeFile{out: filepath.Join(dir, "out"), content: "content", runs: &runs}
+
+	e := New(logger, WithIncremental(filepath.Join(dir, "cache")))
+	e.Run([]pakelib.Command{w, w}, config.New())
+	if runs != 2 {
+		t.Errorf("Expected a command without inputs to run twice but it ran %d times", runs)
+	}
+	if len(e.Skipped()) != 0 {
+		t.Errorf("Expected nothing to be skipped but got %+v", e.Skipped())
+	}
+}
+
+type writeFile struct {
+	inputs  []string
+	out     string
+	content string
+	runs    *int
+}
+
+func (wf *writeFile) Execute(cfg *config.Config, logger *log.Logger) error {
+	*wf.runs++
+	return ioutil.WriteFile(wf.out, []byte(wf.content), 0644)
+}
+
+func (wf *writeFile) Inputs() []string {
+	return wf.inputs
+}
+
+func (wf *writeFile) Outputs() []string {
+	return []string{wf.out}
+}
+
+type copyFile struct {
+	in   string
+	out  string
+	runs int
+}
+
+func (cf *copyFile) Execute(cfg *config.Config, logger *log.Logger) error {
+	cf.runs++
+	content, err := ioutil.ReadFile(cf.in)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cf.out, content, 0644)
+}
+
+func (cf *copyFile) Inputs() []string {
+	return []string{cf.in}
+}
+
+func (cf *copyFile) Outputs() []string {
+	return []string{cf.out}
+}
+
+func (cf *copyFile) Fingerprint() string {
+	return cf.in + " " + cf.out
+}
@@ -0,0 +1,132 @@
+package executor
+
+import (
+	"errors"
+	"log"
+	"log/slog"
+	"time"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// An Invocation describes a command that is being executed.
+type Invocation struct {
+	// Command is the command being executed.
+	Command pakelib.Command
+	// Position is the position of the command in the script.
+	Position pakelib.Position
+	// Config is the Config the command is executed with.
+	Config *config.Config
+	// Logger is the logger passed to the command.
+	Logger *log.Logger
+	// StructuredLogger is the structured logger passed to commands that satisfy
+	// pakelib.StructuredCommand, or nil if the executor has none.
+	StructuredLogger *slog.Logger
+	// Env is the Env passed to commands that satisfy pakelib.EnvCommand, or nil if the
+	// command does not satisfy it.
+	Env *pakelib.Env
+	// Stack is the blocks the command is executed in, outermost first.
+	Stack []Frame
+	// Duration is how long the command took, including retries.  It is set once the
+	// middleware chain has returned.
+	Duration time.Duration
+}
+
+// A Handler executes the command of an invocation and returns its error.
+type Handler func(inv *Invocation) error
+
+// ErrTerminated is returned by a Handler that did not execute the command of an invocation
+// because the script was terminated, such as by a debugger.  The command is not reported,
+// counted or recorded as executed, and the remaining commands are not executed.
+var ErrTerminated = errors.New("The script was terminated")
+
+// A Middleware wraps a Handler with behavior such as timing, auditing, authorization or
+// retries.  It may change the invocation before calling next, skip calling next or change
+// the error next returns.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware wraps the execution of every command with the given middleware.  The first
+// middleware is the outermost one, so it is the first to see an invocation and the last to
+// see its error.  Options that add middleware may be given more than once; middleware added
+// by earlier options wraps middleware added by later ones.  With WithConcurrency, middleware
+// may be called from multiple goroutines at the same time.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(e *Executor) {
+		e.middleware = append(e.middleware, middleware...)
+	}
+}
+
+// WithBeforeCommand calls fn before every command is executed.
+func WithBeforeCommand(fn func(inv *Invocation)) Option {
+	return func(e *Executor) {
+		e.beforeCommand = append(e.beforeCommand, fn)
+	}
+}
+
+// WithAfterCommand calls fn after every command is executed with the error it returned.
+func WithAfterCommand(fn func(inv *Invocation, err error)) Option {
+	return func(e *Executor) {
+		e.afterCommand = append(e.afterCommand, fn)
+	}
+}
+
+// WithOnError calls fn with every error returned by a command instead of writing the error
+// to the logger and the output, allowing errors to be rendered differently.  Errors are
+// always passed to fn in the order of the commands, even with WithConcurrency.
+func WithOnError(fn func(inv *Invocation, err error)) Option {
+	return func(e *Executor) {
+		e.onError = append(e.onError, fn)
+	}
+}
+
+// executeCommand is the Handler at the end of every middleware chain.  Commands that satisfy
+// pakelib.EnvCommand take precedence over commands that satisfy pakelib.StructuredCommand.
+func executeCommand(inv *Invocation) error {
+	if command, ok := inv.Command.(pakelib.EnvCommand); ok && inv.Env != nil {
+		return command.ExecuteEnv(inv.Env, inv.Config, inv.Logger)
+	}
+	if command, ok := inv.Command.(pakelib.StructuredCommand); ok && inv.StructuredLogger != nil {
+		return command.ExecuteStructured(inv.Config, inv.StructuredLogger)
+	}
+	return inv.Command.Execute(inv.Config, inv.Logger)
+}
+
+// handler returns the Handler that executes a command through every middleware, retrying it
+// if a retry policy was given.
+func (e *Executor) handler() Handler {
+	h := e.retry(executeCommand)
+	for i := len(e.middleware) - 1; i >= 0; i-- {
+		h = e.middleware[i](h)
+	}
+	return h
+}
+
+// invoke executes the command of the given invocation through the hooks and middleware, stores
+// the content hash of the command if it succeeded and records its span, profile and
+// coverage.  Only the span is recorded if the command returned ErrTerminated.
+func (e *Executor) invoke(inv *Invocation) error {
+	end := e.trace(inv)
+	for _, fn := range e.beforeCommand {
+		fn(inv)
+	}
+	start := time.Now()
+	err := e.chain(inv)
+	inv.Duration = time.Since(start)
+	if errors.Is(err, ErrTerminated) {
+		end(err)
+		return err
+	}
+	for _, fn := range e.afterCommand {
+		fn(inv, err)
+	}
+	e.finished(inv.Command, err)
+	if e.profile != nil {
+		e.profile.record(inv, err)
+	}
+	if e.coverage != nil {
+		e.coverage.hit(inv.Command, inv.Position)
+	}
+	end(err)
+	return err
+}
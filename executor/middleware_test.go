@@ -0,0 +1,163 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+func TestWithMiddleware_order(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var calls []string
+	named := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(inv *Invocation) error {
+				calls = append(calls, fmt.Sprintf("%s before %s", name, inv.Position))
+				err := next(inv)
+				calls = append(calls, fmt.Sprintf("%s after %s", name, inv.Position))
+				return err
+			}
+		}
+	}
+
+	capturer.CaptureOutput(func() {
+		New(logger, WithMiddleware(named("outer")), WithMiddleware(named("inner"))).
+			Run([]pakelib.Command{&hello{}}, config.New())
+	})
+
+	expected := []string{
+		"outer before line 1",
+		"inner before line 1",
+		"inner after line 1",
+		"outer after line 1",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, calls)
+	}
+}
+
+func TestWithMiddleware_changeserror(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	ignoreErrors := func(next Handler) Handler {
+		return func(inv *Invocation) error {
+			next(inv)
+			return nil
+		}
+	}
+
+	New(logger, WithMiddleware(ignoreErrors)).Run([]pakelib.Command{&byeError{}}, config.New())
+
+	if logOutput.String() != "" {
+		t.Errorf("Expected the error to be swallowed but got %s", logOutput.String())
+	}
+}
+
+func TestWithHooks(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	var calls []string
+	e := New(logger,
+		WithBeforeCommand(func(inv *Invocation) {
+			calls = append(calls, fmt.Sprintf("before %s", inv.Position))
+		}),
+		WithAfterCommand(func(inv *Invocation, err error) {
+			calls = append(calls, fmt.Sprintf("after %s: %v", inv.Position, err))
+		}),
+		WithOnError(func(inv *Invocation, err error) {
+			calls = append(calls, fmt.Sprintf("error %s: %v", inv.Position, err))
+		}),
+	)
+
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{&hello{}, &byeError{}}, config.New())
+	})
+
+	expected := []string{
+		"before line 1",
+		"after line 1: <nil>",
+		"before line 2",
+		"after line 2: Error from bye",
+		"error line 2: Error from bye",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, calls)
+	}
+	if logOutput.String() != "" {
+		t.Errorf("Expected WithOnError to replace the default rendering but got %s",
+			logOutput.String())
+	}
+}
+
+func TestWithOnError_parallelorder(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var errs []string
+	commands := []pakelib.Command{
+		&setter{resource: "a", err: errors.New("Error from a")},
+		&setter{resource: "b", err: errors.New("Error from b")},
+		&setter{resource: "c", err: errors.New("Error from c")},
+	}
+
+	New(logger, WithConcurrency(3), WithOnError(func(inv *Invocation, err error) {
+		errs = append(errs, fmt.Sprintf("%s: %v", inv.Position, err))
+	})).Run(commands, config.New())
+
+	expected := []string{
+		"line 1: Error from a",
+		"line 2: Error from b",
+		"line 3: Error from c",
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, errs)
+	}
+}
+
+func TestWithMiddleware_terminated(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	terminate := func(next Handler) Handler {
+		return func(inv *Invocation) error {
+			if inv.Position.Line >= 2 {
+				return ErrTerminated
+			}
+			return next(inv)
+		}
+	}
+	for _, opts := range [][]Option{nil, {WithConcurrency(3)}, {WithTransaction()}} {
+		var after, failed []int
+		var events bytes.Buffer
+		opts = append(opts, WithMiddleware(terminate), WithEventStream(&events),
+			WithAfterCommand(func(inv *Invocation, err error) {
+				after = append(after, inv.Position.Line)
+			}), WithOnError(func(inv *Invocation, err error) {
+				failed = append(failed, inv.Position.Line)
+			}))
+
+		var err error
+		capturer.CaptureOutput(func() {
+			err = New(logger, opts...).Run([]pakelib.Command{&hello{}, &hello{}, &hello{}},
+				config.New())
+		})
+
+		if err != ErrTerminated {
+			t.Errorf("Expected %v but got %v", ErrTerminated, err)
+		}
+		expectedAfter := []int{1}
+		if !reflect.DeepEqual(after, expectedAfter) {
+			t.Errorf("Expected %v but got %v", expectedAfter, after)
+		}
+		if len(failed) != 0 {
+			t.Errorf("Expected no errors to be reported but got %v", failed)
+		}
+		if !bytes.Contains(events.Bytes(), []byte(`"reason":"terminated"`)) {
+			t.Errorf("Expected the terminated command to be skipped but got %s", events.String())
+		}
+	}
+}
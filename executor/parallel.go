@@ -0,0 +1,261 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// WithConcurrency allows up to n commands that implement pakelib.ResourceUser to be executed
+// at the same time.  Consecutive commands are executed concurrently as long as they do not
+// share any resource; a command that does not implement pakelib.ResourceUser or that uses
+// pakelib.ConfigResource acts as a barrier and is executed on its own once every command
+// before it has finished.
+//
+// Each concurrent command is given its own logger and its own copy of the Config as it would
+// be if the commands before it in the group had been executed one at a time without changing
+// it, so temporary values set before the group expire at the same command as they would
+// without WithConcurrency.  Once a group of concurrent commands has finished, the values each
+// command set or cleared are copied back, its log output is written and its error is reported
+// in the order of the commands, followed by SmartReset().  As long as every command that
+// changes the Config uses pakelib.ConfigResource, the results are the same as if the commands
+// had been executed one at a time.  Otherwise, the changes a command makes to the Config are
+// not seen by the other commands of its group, and only the most recent temporary value a
+// command set for a key is copied back.
+func WithConcurrency(n int) Option {
+	return func(e *Executor) {
+		e.concurrency = n
+	}
+}
+
+// A result holds what a command executed concurrently produced.
+type result struct {
+	cfg      *config.Config
+	logs     bytes.Buffer
+	err      error
+	before   []config.Entry
+	skipped  string
+	duration time.Duration
+}
+
+// runParallel executes the commands in groups of consecutive commands that do not share any
+// resource.  It returns a *CommandError for the first command that failed, if any, or
+// ErrTerminated once a command was terminated.  The groups after the one with the first failed
+// command are not executed if the Executor stops at failures.
+func (e *Executor) runParallel(commands []pakelib.Command, positions []pakelib.Position,
+	cfg *config.Config) error {
+	var errs []error
+	stop := func(err error) bool {
+		errs = append(errs, err)
+		return errors.Is(err, ErrTerminated) || (err != nil && e.stopsAtFailure())
+	}
+	start := 0
+	used := make(map[string]bool)
+	for i, command := range commands {
+		resourceUser, ok := command.(pakelib.ResourceUser)
+		if !ok || usesConfig(resourceUser) {
+			if stop(e.runGroup(commands[start:i], positions[start:i], cfg)) {
+				return errs[len(errs)-1]
+			}
+			_, err := e.execute(positions[i], command, cfg)
+			if stop(failure(positions[i], err)) {
+				return errs[len(errs)-1]
+			}
+			start = i + 1
+			used = make(map[string]bool)
+			continue
+		}
+		resources := resourceUser.Resources()
+		if conflicts(used, resources) {
+			if stop(e.runGroup(commands[start:i], positions[start:i], cfg)) {
+				return errs[len(errs)-1]
+			}
+			start = i
+			used = make(map[string]bool)
+		}
+		for _, resource := range resources {
+			used[resource] = true
+		}
+	}
+	if stop(e.runGroup(commands[start:], positions[start:], cfg)) {
+		return errs[len(errs)-1]
+	}
+	return firstError(errs)
+}
+
+// firstError returns the first error in errs that is not nil, or nil if there is none.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usesConfig checks to see if the given command changes the Config.
+func usesConfig(resourceUser pakelib.ResourceUser) bool {
+	for _, resource := range resourceUser.Resources() {
+		if resource == pakelib.ConfigResource {
+			return true
+		}
+	}
+	return false
+}
+
+// conflicts checks to see if any of the given resources is already used.
+func conflicts(used map[string]bool, resources []string) bool {
+	for _, resource := range resources {
+		if used[resource] {
+			return true
+		}
+	}
+	return false
+}
+
+// runGroup executes the given commands concurrently and merges their results in order.  It
+// returns a *CommandError for the first command that failed, if any.  Once a command was
+// terminated, neither it nor the commands after it are merged and ErrTerminated is returned.
+func (e *Executor) runGroup(commands []pakelib.Command, positions []pakelib.Position,
+	cfg *config.Config) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	if len(commands) == 1 {
+		_, err := e.execute(positions[0], commands[0], cfg)
+		return failure(positions[0], err)
+	}
+
+	forks := forkConfig(cfg, len(commands))
+	stack := e.CallStack()
+	results := make([]*result, len(commands))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	workers := e.concurrency
+	if workers > len(results) {
+		workers = len(results)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				r := &result{cfg: forks[i], before: forks[i].All()}
+				logger := log.New(&r.logs, e.logger.Prefix(), e.logger.Flags())
+				r.cfg.SetSource(positions[i].String())
+				if reason, ok := e.upToDate(commands[i]); ok {
+					r.skipped = reason
+				} else {
+					inv := e.newInvocation(positions[i], commands[i], r.cfg, logger, stack)
+					r.err = e.invoke(inv)
+					r.duration = inv.Duration
+				}
+				results[i] = r
+			}
+		}()
+	}
+	for i := range commands {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for i, r := range results {
+		if errors.Is(r.err, ErrTerminated) {
+			e.emitCommand(CommandStarted, positions[i], commands[i])
+			e.emitSkip(positions[i], terminatedReason)
+			return ErrTerminated
+		}
+		state := e.stateFor(cfg)
+		cfg.SetSource(positions[i].String())
+		if r.skipped == "" {
+			e.emitCommand(CommandStarted, positions[i], commands[i])
+		}
+		if err := mergeConfig(cfg, r.before, r.cfg.All()); err != nil {
+			r.err = errors.Join(r.err, err)
+		}
+		e.checkpoint(positions[i], state, r.err)
+		e.logger.Writer().Write(r.logs.Bytes())
+		if r.skipped != "" {
+			e.skip(positions[i], r.skipped)
+		} else {
+			inv := e.newInvocation(positions[i], commands[i], cfg, e.logger, stack)
+			inv.Duration = r.duration
+			e.report(inv, r.err)
+		}
+		cfg.SmartReset()
+	}
+	errs := make([]error, len(results))
+	for i, r := range results {
+		errs[i] = failure(positions[i], r.err)
+	}
+	return firstError(errs)
+}
+
+// forkConfig returns n copies of the given Config, the copy at index i having been passed to
+// SmartReset() i times.
+func forkConfig(cfg *config.Config, n int) []*config.Config {
+	forks := make([]*config.Config, n)
+	forks[0] = cfg.Clone()
+	for i := 1; i < n; i++ {
+		forks[i] = forks[i-1].Clone()
+		forks[i].SmartReset()
+	}
+	return forks
+}
+
+// mergeConfig applies every difference between the entries in before and after to the given
+// Config: entries that changed are set and entries that are missing from after are cleared.
+// It returns an error naming every entry that the Config rejected.
+func mergeConfig(cfg *config.Config, before, after []config.Entry) error {
+	previous := make(map[string]config.Entry, len(before))
+	for _, entry := range before {
+		previous[entry.Key] = entry
+	}
+	var errs []error
+	for _, entry := range after {
+		old, ok := previous[entry.Key]
+		delete(previous, entry.Key)
+		if ok && entry == old {
+			continue
+		}
+		var err error
+		switch entry.Provenance {
+		case config.Permanent:
+			if ok && old.Provenance == config.Temporary {
+				cfg.ResetKey(entry.Key)
+			}
+			if current, ok := entryOf(cfg, entry.Key); !ok || current != entry {
+				err = cfg.SetPermanently(entry.Key, entry.Value)
+			}
+		case config.Temporary:
+			err = cfg.SetFor(entry.Key, entry.Value, entry.Remaining)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Can't copy back the value of %s: %s", entry.Key,
+				err.Error()))
+		}
+	}
+	for _, entry := range before {
+		if _, ok := previous[entry.Key]; ok {
+			cfg.ResetKey(entry.Key)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// entryOf returns the entry of the given key in the given Config.
+func entryOf(cfg *config.Config, key string) (config.Entry, bool) {
+	for _, entry := range cfg.All() {
+		if entry.Key == key {
+			return entry, true
+		}
+	}
+	return config.Entry{}, false
+}
@@ -0,0 +1,264 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+func TestRun_parallelconcurrent(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	var started sync.WaitGroup
+	started.Add(3)
+	commands := []pakelib.Command{
+		&rendezvous{resource: "a", started: &started},
+		&pakelib.Comment{},
+		&rendezvous{resource: "b", started: &started},
+		&rendezvous{resource: "c", started: &started},
+	}
+
+	done := make(chan bool)
+	go func() {
+		New(logger, WithConcurrency(3)).Run(commands, config.New())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Commands that do not share resources were not executed concurrently")
+	}
+	expectedLogOutput := "rendezvous a\nrendezvous b\nrendezvous c\n"
+	if logOutput.String() != expectedLogOutput {
+		t.Errorf("Expected %s but got %s", expectedLogOutput, logOutput.String())
+	}
+}
+
+func TestRun_parallelsharedresource(t *testing.T) {
+	logger := log.New(&bytes.Buffer{}, "", 0)
+	var mu sync.Mutex
+	running := 0
+	maxRunning := 0
+	track := func(delta int) {
+		mu.Lock()
+		defer mu.Unlock()
+		running += delta
+		if running > maxRunning {
+			maxRunning = running
+		}
+	}
+	commands := []pakelib.Command{
+		&tracked{resource: "file", track: track},
+		&tracked{resource: "file", track: track},
+		&tracked{resource: "file", track: track},
+	}
+
+	New(logger, WithConcurrency(3)).Run(commands, config.New())
+
+	if maxRunning != 1 {
+		t.Errorf("Expected commands sharing a resource to run one at a time but %d ran at once",
+			maxRunning)
+	}
+}
+
+func TestRun_parallelmerge(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	cfg := config.New()
+	history := config.NewHistory(cfg)
+	commands := []pakelib.Command{
+		&setter{resource: "a", key: "first", value: "1", temporary: true},
+		&setter{resource: "b", key: "second", value: "2"},
+		&setter{resource: "c", err: errors.New("Error from c")},
+		&setter{resource: "d", key: "second", value: "4"},
+	}
+
+	capturer.CaptureOutput(func() {
+		New(logger, WithConcurrency(4)).Run(commands, cfg)
+	})
+
+	value, _ := cfg.Get("second")
+	if value != "4" {
+		t.Errorf("Expected 4 but got %s", value)
+	}
+	if _, err := cfg.Get("first"); err == nil {
+		t.Error("Expected the temporary value of first to have expired")
+	}
+	changes := history.Changes("first")
+	if len(changes) != 2 || changes[0].Source != "line 1" || changes[1].Source != "line 2" {
+		t.Errorf("Expected first to be set by line 1 and expire after line 2 but got %+v", changes)
+	}
+	expectedLogOutput := "setter a\nsetter b\nsetter c\n" +
+		"There was an error at line 3: Error from c\nsetter d\n"
+	if logOutput.String() != expectedLogOutput {
+		t.Errorf("Expected %s but got %s", expectedLogOutput, logOutput.String())
+	}
+}
+
+func TestRun_parallelagesconfig(t *testing.T) {
+	logger := log.New(&bytes.Buffer{}, "", 0)
+	run := func(opts ...Option) []string {
+		seen := make([]string, 3)
+		commands := []pakelib.Command{
+			&reader{resource: "a", key: "key", seen: &seen[0]},
+			&reader{resource: "b", key: "key", seen: &seen[1]},
+			&reader{resource: "c", key: "key", seen: &seen[2]},
+		}
+		cfg := config.New()
+		cfg.SetFor("key", "value", 1)
+		New(logger, opts...).Run(commands, cfg)
+		return seen
+	}
+
+	sequential := run()
+	concurrent := run(WithConcurrency(3))
+
+	expected := []string{"value", "value", ""}
+	if !reflect.DeepEqual(sequential, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, sequential)
+	}
+	if !reflect.DeepEqual(concurrent, expected) {
+		t.Errorf("Expected %+q but got %+q", expected, concurrent)
+	}
+}
+
+func TestRun_parallelconfigbarrier(t *testing.T) {
+	logger := log.New(&bytes.Buffer{}, "", 0)
+	var seen string
+	commands := []pakelib.Command{
+		&setter{resource: pakelib.ConfigResource, key: "key", value: "1", temporary: true},
+		&reader{resource: "b", key: "key", seen: &seen},
+	}
+
+	capturer.CaptureOutput(func() {
+		New(logger, WithConcurrency(2)).Run(commands, config.New())
+	})
+
+	if seen != "1" {
+		t.Errorf("Expected 1 but got %s", seen)
+	}
+}
+
+func TestRun_parallelmergereset(t *testing.T) {
+	logger := log.New(&bytes.Buffer{}, "", 0)
+	cfg := config.New()
+	cfg.SetFor("key", "value", 5)
+	commands := []pakelib.Command{
+		&resetter{resource: "a"},
+		&tracked{resource: "b", track: func(int) {}},
+	}
+
+	New(logger, WithConcurrency(2)).Run(commands, cfg)
+
+	if value, err := cfg.Get("key"); err == nil {
+		t.Errorf("Expected the temporary value of key to be cleared but got %s", value)
+	}
+}
+
+func TestMergeConfig_rejected(t *testing.T) {
+	cfg := config.New()
+	cfg.Declare(config.Flag{Name: "count", Type: config.Int})
+	after := []config.Entry{{Key: "count", Value: "many", Provenance: config.Permanent}}
+
+	err := mergeConfig(cfg, nil, after)
+
+	if err == nil {
+		t.Fatal("Expected an error copying back a value the Config rejects")
+	}
+	expectedErr := `Can't copy back the value of count: Can't use "many" for count: ` +
+		"expected a value of type int"
+	if err.Error() != expectedErr {
+		t.Errorf("Expected %s but got %s", expectedErr, err.Error())
+	}
+}
+
+type rendezvous struct {
+	resource string
+	started  *sync.WaitGroup
+}
+
+func (r *rendezvous) Execute(cfg *config.Config, logger *log.Logger) error {
+	r.started.Done()
+	r.started.Wait()
+	logger.Printf("rendezvous %s", r.resource)
+	return nil
+}
+
+func (r *rendezvous) Resources() []string {
+	return []string{r.resource}
+}
+
+type tracked struct {
+	resource string
+	track    func(int)
+}
+
+func (tr *tracked) Execute(cfg *config.Config, logger *log.Logger) error {
+	tr.track(1)
+	time.Sleep(10 * time.Millisecond)
+	tr.track(-1)
+	return nil
+}
+
+func (tr *tracked) Resources() []string {
+	return []string{tr.resource}
+}
+
+type setter struct {
+	resource  string
+	key       string
+	value     string
+	temporary bool
+	err       error
+}
+
+func (s *setter) Execute(cfg *config.Config, logger *log.Logger) error {
+	logger.Printf("setter %s", s.resource)
+	if s.err != nil {
+		return s.err
+	}
+	if s.temporary {
+		return cfg.SetTemporarily(s.key, s.value)
+	}
+	return cfg.SetPermanently(s.key, s.value)
+}
+
+func (s *setter) Resources() []string {
+	return []string{s.resource}
+}
+
+type reader struct {
+	resource string
+	key      string
+	seen     *string
+}
+
+func (r *reader) Execute(cfg *config.Config, logger *log.Logger) error {
+	*r.seen, _ = cfg.Get(r.key)
+	return nil
+}
+
+func (r *reader) Resources() []string {
+	return []string{r.resource}
+}
+
+type resetter struct {
+	resource string
+}
+
+func (r *resetter) Execute(cfg *config.Config, logger *log.Logger) error {
+	cfg.Reset()
+	return nil
+}
+
+func (r *resetter) Resources() []string {
+	return []string{r.resource}
+}
@@ -0,0 +1,227 @@
+package executor
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	pakelib "github.com/pake-go/pake-lib"
+)
+
+// A Sample aggregates every execution of the commands at a position or of a type of command.
+type Sample struct {
+	// Position is the position of the commands, or the zero Position for a type of command.
+	Position pakelib.Position
+	// Command is the type of the commands.
+	Command string
+	// Calls is how many times the commands were executed.
+	Calls int
+	// Errors is how many times the commands returned an error.
+	Errors int
+	// WallTime is how long the commands took in total, including retries.
+	WallTime time.Duration
+}
+
+// add records one execution of a command that took the given time.
+func (s *Sample) add(wallTime time.Duration, err error) {
+	s.Calls++
+	s.WallTime += wallTime
+	if err != nil {
+		s.Errors++
+	}
+}
+
+// A Profile aggregates how many times, how long and how often with an error the commands
+// executed by the Executors it is given to ran, per position and per type of command.  A
+// Profile is safe for concurrent use by multiple goroutines.
+type Profile struct {
+	// Guards every field below.
+	mu sync.Mutex
+	// Represents the samples of each position.
+	positions map[pakelib.Position]*Sample
+	// Represents the samples of each type of command.
+	commands map[string]*Sample
+	// Represents when the first command was recorded.
+	start time.Time
+	// Represents when the last command was recorded.
+	end time.Time
+}
+
+// NewProfile returns an empty Profile.
+func NewProfile() *Profile {
+	return &Profile{
+		positions: make(map[pakelib.Position]*Sample),
+		commands:  make(map[string]*Sample),
+	}
+}
+
+// WithProfile records every command executed by the Executor in the given Profile.  Commands
+// skipped because their outputs are up to date are not recorded.
+func WithProfile(p *Profile) Option {
+	return func(e *Executor) {
+		e.profile = p
+	}
+}
+
+// record adds the execution of the command of the given invocation to the Profile.
+func (p *Profile) record(inv *Invocation, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	command := fmt.Sprintf("%T", inv.Command)
+	if _, ok := p.positions[inv.Position]; !ok {
+		p.positions[inv.Position] = &Sample{Position: inv.Position, Command: command}
+	}
+	p.positions[inv.Position].add(inv.Duration, err)
+	if _, ok := p.commands[command]; !ok {
+		p.commands[command] = &Sample{Command: command}
+	}
+	p.commands[command].add(inv.Duration, err)
+	now := time.Now()
+	if p.start.IsZero() {
+		p.start = now.Add(-inv.Duration)
+	}
+	p.end = now
+}
+
+// Lines returns the samples of each position sorted from the longest total wall time to the
+// shortest.
+func (p *Profile) Lines() []Sample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	samples := make([]Sample, 0, len(p.positions))
+	for _, sample := range p.positions {
+		samples = append(samples, *sample)
+	}
+	sortSamples(samples)
+	return samples
+}
+
+// Commands returns the samples of each type of command sorted from the longest total wall
+// time to the shortest.
+func (p *Profile) Commands() []Sample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	samples := make([]Sample, 0, len(p.commands))
+	for _, sample := range p.commands {
+		samples = append(samples, *sample)
+	}
+	sortSamples(samples)
+	return samples
+}
+
+// sortSamples sorts the given samples from the longest total wall time to the shortest, then
+// by position and type of command.
+func sortSamples(samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		a, b := samples[i], samples[j]
+		if a.WallTime != b.WallTime {
+			return a.WallTime > b.WallTime
+		}
+		if a.Position.File != b.Position.File {
+			return a.Position.File < b.Position.File
+		}
+		if a.Position.Line != b.Position.Line {
+			return a.Position.Line < b.Position.Line
+		}
+		return a.Command < b.Command
+	})
+}
+
+// WriteReport writes a table of the samples of each position followed by a table of the
+// samples of each type of command, both sorted from the slowest to the fastest, to the given
+// writer.
+func (p *Profile) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "POSITION\tCOMMAND\tCALLS\tERRORS\tTOTAL\tAVERAGE")
+	for _, sample := range p.Lines() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", sample.Position, sample.Command, sample.columns())
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "COMMAND\tCALLS\tERRORS\tTOTAL\tAVERAGE")
+	for _, sample := range p.Commands() {
+		fmt.Fprintf(tw, "%s\t%s\n", sample.Command, sample.columns())
+	}
+	return tw.Flush()
+}
+
+// columns returns the calls, errors, total and average wall time of the sample separated by
+// tabs.
+func (s Sample) columns() string {
+	var average time.Duration
+	if s.Calls != 0 {
+		average = s.WallTime / time.Duration(s.Calls)
+	}
+	return fmt.Sprintf("%d\t%d\t%s\t%s", s.Calls, s.Errors, s.WallTime, average)
+}
+
+// WritePprof writes the samples of each position to the given writer as a gzipped profile in
+// the format read by pprof, so that it can be inspected with `go tool pprof`.  Each position is
+// a location whose function is named after the type of the command and whose file and line
+// are those of the script.  Every sample has a calls, an errors and a wall time value.
+func (p *Profile) WritePprof(w io.Writer) error {
+	lines := p.Lines()
+	p.mu.Lock()
+	start, end := p.start, p.end
+	p.mu.Unlock()
+
+	var profile, samples, locations, functions protoBuffer
+	table := newStringTable()
+	for _, valueType := range [][2]string{
+		{"calls", "count"},
+		{"errors", "count"},
+		{"wall", "nanoseconds"},
+	} {
+		var vt protoBuffer
+		vt.int64(1, table.index(valueType[0]))
+		vt.int64(2, table.index(valueType[1]))
+		profile.message(1, vt)
+	}
+	functionIDs := make(map[[2]string]uint64)
+	for i, sample := range lines {
+		locationID := uint64(i + 1)
+		key := [2]string{sample.Command, sample.Position.File}
+		functionID, ok := functionIDs[key]
+		if !ok {
+			functionID = uint64(len(functionIDs) + 1)
+			functionIDs[key] = functionID
+			var function protoBuffer
+			function.uint64(1, functionID)
+			function.int64(2, table.index(sample.Command))
+			function.int64(3, table.index(sample.Command))
+			function.int64(4, table.index(sample.Position.File))
+			functions.message(5, function)
+		}
+
+		var line, location, s protoBuffer
+		line.uint64(1, functionID)
+		line.int64(2, int64(sample.Position.Line))
+		location.uint64(1, locationID)
+		location.message(4, line)
+		locations.message(4, location)
+
+		s.packed(1, []uint64{locationID})
+		s.packed(2, []uint64{uint64(sample.Calls), uint64(sample.Errors),
+			uint64(sample.WallTime.Nanoseconds())})
+		samples.message(2, s)
+	}
+	profile = append(profile, samples...)
+	profile = append(profile, locations...)
+	profile = append(profile, functions...)
+	for _, str := range table.strings {
+		profile.string(6, str)
+	}
+	if !start.IsZero() {
+		profile.int64(9, start.UnixNano())
+		profile.int64(10, end.Sub(start).Nanoseconds())
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,186 @@
+package executor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+func newProfile() *Profile {
+	p := NewProfile()
+	for _, inv := range []struct {
+		line     int
+		command  pakelib.Command
+		duration time.Duration
+		err      error
+	}{
+		{1, &hello{}, time.Second, nil},
+		{2, &byeError{}, 3 * time.Second, errors.New("Error from bye")},
+		{1, &hello{}, time.Second, nil},
+	} {
+		p.record(&Invocation{
+			Command:  inv.command,
+			Position: pakelib.Position{File: "pakefile", Line: inv.line},
+			Duration: inv.duration,
+		}, inv.err)
+	}
+	return p
+}
+
+func TestWithProfile(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	profile := NewProfile()
+
+	capturer.CaptureOutput(func() {
+		New(logger, WithProfile(profile)).Run([]pakelib.Command{&hello{}, &byeError{}, &hello{}},
+			config.New())
+	})
+
+	calls := make(map[string]int)
+	for _, sample := range profile.Lines() {
+		calls[sample.Position.String()] = sample.Calls
+	}
+	expectedCalls := map[string]int{"line 1": 1, "line 2": 1, "line 3": 1}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("Expected %+v but got %+v", expectedCalls, calls)
+	}
+	commands := profile.Commands()
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 types of command but got %+v", commands)
+	}
+	for _, sample := range commands {
+		if sample.Command == "*executor.hello" && sample.Calls != 2 {
+			t.Errorf("Expected 2 calls but got %+v", sample)
+		}
+		if sample.Command == "*executor.byeError" && sample.Errors != 1 {
+			t.Errorf("Expected 1 error but got %+v", sample)
+		}
+	}
+}
+
+func TestProfile_Lines(t *testing.T) {
+	p := newProfile()
+
+	expectedLines := []Sample{
+		{Position: pakelib.Position{File: "pakefile", Line: 2}, Command: "*executor.byeError",
+			Calls: 1, Errors: 1, WallTime: 3 * time.Second},
+		{Position: pakelib.Position{File: "pakefile", Line: 1}, Command: "*executor.hello",
+			Calls: 2, WallTime: 2 * time.Second},
+	}
+	if !reflect.DeepEqual(p.Lines(), expectedLines) {
+		t.Errorf("Expected %+v but got %+v", expectedLines, p.Lines())
+	}
+}
+
+func TestProfile_WriteReport(t *testing.T) {
+	p := newProfile()
+
+	var buf bytes.Buffer
+	if err := p.WriteReport(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	expectedFields := [][]string{
+		{"POSITION", "COMMAND", "CALLS", "ERRORS", "TOTAL", "AVERAGE"},
+		{"pakefile:2", "*executor.byeError", "1", "1", "3s", "3s"},
+		{"pakefile:1", "*executor.hello", "2", "0", "2s", "1s"},
+		{},
+		{"COMMAND", "CALLS", "ERRORS", "TOTAL", "AVERAGE"},
+		{"*executor.byeError", "1", "1", "3s", "3s"},
+		{"*executor.hello", "2", "0", "2s", "1s"},
+		{},
+	}
+	if len(lines) != len(expectedFields) {
+		t.Fatalf("Expected %d lines but got %d: %s", len(expectedFields), len(lines), buf.String())
+	}
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			fields = []string{}
+		}
+		if len(expectedFields[i]) != 0 && !reflect.DeepEqual(fields, expectedFields[i]) {
+			t.Errorf("Expected %+q but got %+q", expectedFields[i], fields)
+		}
+	}
+}
+
+// protoFields decodes the top level fields of the given protocol buffer message, keyed by field
+// number, returning varints as uint64 and length-delimited fields as []byte.
+func protoFields(t *testing.T, message []byte) map[int][]interface{} {
+	fields := make(map[int][]interface{})
+	for len(message) != 0 {
+		key, n := binary.Uvarint(message)
+		message = message[n:]
+		value, n := binary.Uvarint(message)
+		message = message[n:]
+		switch key & 7 {
+		case varintWireType:
+			fields[int(key>>3)] = append(fields[int(key>>3)], value)
+		case bytesWireType:
+			fields[int(key>>3)] = append(fields[int(key>>3)], message[:value])
+			message = message[value:]
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestProfile_WritePprof(t *testing.T) {
+	p := newProfile()
+
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := protoFields(t, data)
+
+	var table []string
+	for _, str := range fields[6] {
+		table = append(table, string(str.([]byte)))
+	}
+	expectedTable := []string{"", "calls", "count", "errors", "wall", "nanoseconds",
+		"*executor.byeError", "pakefile", "*executor.hello"}
+	if !reflect.DeepEqual(table, expectedTable) {
+		t.Errorf("Expected %+q but got %+q", expectedTable, table)
+	}
+	if len(fields[1]) != 3 || len(fields[2]) != 2 || len(fields[4]) != 2 || len(fields[5]) != 2 {
+		t.Errorf("Unexpected number of sample types, samples, locations or functions: %v", fields)
+	}
+	sample := protoFields(t, fields[2][1].([]byte))
+	values := sample[2][0].([]byte)
+	var decoded []uint64
+	for len(values) != 0 {
+		value, n := binary.Uvarint(values)
+		decoded = append(decoded, value)
+		values = values[n:]
+	}
+	expectedValues := []uint64{2, 0, uint64(2 * time.Second)}
+	if !reflect.DeepEqual(decoded, expectedValues) {
+		t.Errorf("Expected %+v but got %+v", expectedValues, decoded)
+	}
+	location := protoFields(t, fields[4][1].([]byte))
+	line := protoFields(t, location[4][0].([]byte))
+	if line[2][0] != uint64(1) {
+		t.Errorf("Expected line 1 but got %v", line[2][0])
+	}
+}
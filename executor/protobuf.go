@@ -0,0 +1,82 @@
+package executor
+
+import "encoding/binary"
+
+// A protoBuffer encodes the fields of a protocol buffer message.  Only the wire types needed to
+// write pprof profiles are supported.
+type protoBuffer []byte
+
+// Wire types of protocol buffer fields.
+const (
+	varintWireType = 0
+	bytesWireType  = 2
+)
+
+// key appends the key of the given field with the given wire type.
+func (b *protoBuffer) key(field int, wireType int) {
+	*b = binary.AppendUvarint(*b, uint64(field)<<3|uint64(wireType))
+}
+
+// uint64 appends the given field as a varint, omitting it if it is zero.
+func (b *protoBuffer) uint64(field int, value uint64) {
+	if value == 0 {
+		return
+	}
+	b.key(field, varintWireType)
+	*b = binary.AppendUvarint(*b, value)
+}
+
+// int64 appends the given field as a varint, omitting it if it is zero.
+func (b *protoBuffer) int64(field int, value int64) {
+	b.uint64(field, uint64(value))
+}
+
+// bytes appends the given field as length-delimited bytes.
+func (b *protoBuffer) bytes(field int, value []byte) {
+	b.key(field, bytesWireType)
+	*b = binary.AppendUvarint(*b, uint64(len(value)))
+	*b = append(*b, value...)
+}
+
+// string appends the given field as length-delimited bytes, even if it is empty.
+func (b *protoBuffer) string(field int, value string) {
+	b.bytes(field, []byte(value))
+}
+
+// message appends the given embedded message as the given field.
+func (b *protoBuffer) message(field int, message protoBuffer) {
+	b.bytes(field, message)
+}
+
+// packed appends the given repeated field as packed varints.
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var packed []byte
+	for _, value := range values {
+		packed = binary.AppendUvarint(packed, value)
+	}
+	b.bytes(field, packed)
+}
+
+// A stringTable assigns an index to every string of a pprof profile.  The first string is
+// always the empty string.
+type stringTable struct {
+	// Represents the strings in the order of their index.
+	strings []string
+	// Represents the index of each string.
+	indices map[string]int64
+}
+
+// newStringTable returns a stringTable holding only the empty string.
+func newStringTable() *stringTable {
+	return &stringTable{strings: []string{""}, indices: map[string]int64{"": 0}}
+}
+
+// index returns the index of the given string, adding it to the table if needed.
+func (t *stringTable) index(str string) int64 {
+	if i, ok := t.indices[str]; ok {
+		return i
+	}
+	t.indices[str] = int64(len(t.strings))
+	t.strings = append(t.strings, str)
+	return t.indices[str]
+}
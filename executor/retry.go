@@ -0,0 +1,155 @@
+package executor
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"time"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+const (
+	// RetryAttemptsKey is the Config key that overrides the maximum number of attempts of
+	// the retry policy for a command, such as by setting it temporarily on the line before.
+	RetryAttemptsKey = "retry_attempts"
+	// RetryBackoffKey is the Config key that overrides the initial backoff of the retry
+	// policy for a command, in a format accepted by time.ParseDuration.
+	RetryBackoffKey = "retry_backoff"
+)
+
+// DeclareRetryFlags declares RetryAttemptsKey and RetryBackoffKey in the given Config, so that
+// they can still be set once the Config has a schema.  It returns an error if either of them
+// has already been declared.
+func DeclareRetryFlags(cfg *config.Config) error {
+	if err := cfg.Declare(config.Flag{
+		Name:        RetryAttemptsKey,
+		Type:        config.Int,
+		Description: "The maximum number of times the next command is executed",
+	}); err != nil {
+		return err
+	}
+	return cfg.Declare(config.Flag{
+		Name:        RetryBackoffKey,
+		Type:        config.Duration,
+		Description: "How long to wait before retrying the next command for the first time",
+	})
+}
+
+// A RetryPolicy describes how a failed command is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the command is executed, including the
+	// first attempt.  A command is not retried if MaxAttempts is less than 2.
+	MaxAttempts int
+	// InitialBackoff is how long to wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the longest time to wait before a retry.  There is no limit if it is 0.
+	MaxBackoff time.Duration
+	// Multiplier is how much the backoff grows after each retry.  It defaults to 2.
+	Multiplier float64
+	// Jitter is the fraction of the backoff that is randomly added or removed, from 0 to 1,
+	// so that commands failing together do not retry together.
+	Jitter float64
+	// Retryable checks to see if an error should be retried.  It defaults to IsTemporary.
+	Retryable func(error) bool
+}
+
+// IsTemporary checks to see if the given error, or any error it wraps, has a Temporary()
+// method that returns true.
+func IsTemporary(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// backoff returns how long to wait before the given retry, starting at 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		d *= multiplier
+		if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// retryable checks to see if the given error should be retried.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTemporary(err)
+}
+
+// WithRetry retries every failed command according to the given policy unless a policy was
+// given for the command's type with WithRetryFor.  The policy of a single command can be
+// changed by setting RetryAttemptsKey or RetryBackoffKey in the Config, such as temporarily
+// on the line before it; a Config with a schema must declare them with DeclareRetryFlags.
+// Retries happen inside every middleware, so middleware sees each command once.
+func WithRetry(policy RetryPolicy) Option {
+	return func(e *Executor) {
+		e.retryPolicy = &policy
+	}
+}
+
+// WithRetryFor retries failed commands of the same type as the given command according to
+// the given policy.
+func WithRetryFor(command pakelib.Command, policy RetryPolicy) Option {
+	return func(e *Executor) {
+		if e.retryPolicies == nil {
+			e.retryPolicies = make(map[reflect.Type]RetryPolicy)
+		}
+		e.retryPolicies[reflect.TypeOf(command)] = policy
+	}
+}
+
+// policyFor returns the retry policy for the given invocation.
+func (e *Executor) policyFor(inv *Invocation) RetryPolicy {
+	var policy RetryPolicy
+	if p, ok := e.retryPolicies[reflect.TypeOf(inv.Command)]; ok {
+		policy = p
+	} else if e.retryPolicy != nil {
+		policy = *e.retryPolicy
+	}
+	if attempts, err := inv.Config.GetInt(RetryAttemptsKey, policy.MaxAttempts); err == nil {
+		policy.MaxAttempts = attempts
+	} else {
+		inv.Logger.Println(err.Error())
+	}
+	if backoff, err := inv.Config.GetDuration(RetryBackoffKey, policy.InitialBackoff); err == nil {
+		policy.InitialBackoff = backoff
+	} else {
+		inv.Logger.Println(err.Error())
+	}
+	return policy
+}
+
+// retry wraps the given handler so that failed commands are retried.
+func (e *Executor) retry(next Handler) Handler {
+	return func(inv *Invocation) error {
+		policy := e.policyFor(inv)
+		err := next(inv)
+		for attempt := 2; err != nil && attempt <= policy.MaxAttempts; attempt++ {
+			if !policy.retryable(err) {
+				break
+			}
+			backoff := policy.backoff(attempt - 1)
+			inv.Logger.Printf("Retrying %s (attempt %d of %d) in %s: %s", inv.Position, attempt,
+				policy.MaxAttempts, backoff, err.Error())
+			e.sleep(backoff)
+			err = next(inv)
+		}
+		return err
+	}
+}
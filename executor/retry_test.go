@@ -0,0 +1,203 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+func TestWithRetry_temporaryerror(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	f := &flaky{failures: 2, err: temporaryError{}}
+	var sleeps []time.Duration
+
+	e := New(logger, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second}))
+	e.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	e.Run([]pakelib.Command{f}, config.New())
+
+	if f.attempts != 3 {
+		t.Errorf("Expected 3 attempts but got %d", f.attempts)
+	}
+	expectedSleeps := []time.Duration{time.Second, 2 * time.Second}
+	if !reflect.DeepEqual(sleeps, expectedSleeps) {
+		t.Errorf("Expected %v but got %v", expectedSleeps, sleeps)
+	}
+	expectedLogOutput := "Retrying line 1 (attempt 2 of 3) in 1s: Temporary error\n" +
+		"Retrying line 1 (attempt 3 of 3) in 2s: Temporary error\n"
+	if logOutput.String() != expectedLogOutput {
+		t.Errorf("Expected %s but got %s", expectedLogOutput, logOutput.String())
+	}
+}
+
+func TestWithRetry_nonretryableerror(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	f := &flaky{failures: 2, err: errors.New("Permanent error")}
+
+	e := New(logger, WithRetry(RetryPolicy{MaxAttempts: 3}))
+	e.sleep = func(time.Duration) {}
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{f}, config.New())
+	})
+
+	if f.attempts != 1 {
+		t.Errorf("Expected 1 attempt but got %d", f.attempts)
+	}
+}
+
+func TestWithRetry_predicate(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	permanent := errors.New("Permanent error")
+	f := &flaky{failures: 5, err: permanent}
+
+	e := New(logger, WithRetry(RetryPolicy{
+		MaxAttempts: 3,
+		Retryable: func(err error) bool {
+			return errors.Is(err, permanent)
+		},
+	}))
+	e.sleep = func(time.Duration) {}
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{f}, config.New())
+	})
+
+	if f.attempts != 3 {
+		t.Errorf("Expected 3 attempts but got %d", f.attempts)
+	}
+}
+
+func TestWithRetryFor_commandtype(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	f := &flaky{failures: 3, err: temporaryError{}}
+
+	e := New(logger,
+		WithRetry(RetryPolicy{MaxAttempts: 2}),
+		WithRetryFor(&flaky{}, RetryPolicy{MaxAttempts: 4}))
+	e.sleep = func(time.Duration) {}
+	e.Run([]pakelib.Command{f}, config.New())
+
+	if f.attempts != 4 {
+		t.Errorf("Expected 4 attempts but got %d", f.attempts)
+	}
+}
+
+func TestRetry_configflag(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	first := &flaky{failures: 3, err: temporaryError{}}
+	second := &flaky{failures: 3, err: temporaryError{}}
+	var sleeps []time.Duration
+
+	e := New(logger)
+	e.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{&setRetries{}, first, second}, config.New())
+	})
+
+	if first.attempts != 4 {
+		t.Errorf("Expected 4 attempts for the line after the flag but got %d", first.attempts)
+	}
+	if second.attempts != 1 {
+		t.Errorf("Expected 1 attempt once the flag expired but got %d", second.attempts)
+	}
+	expectedSleeps := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(sleeps, expectedSleeps) {
+		t.Errorf("Expected %v but got %v", expectedSleeps, sleeps)
+	}
+}
+
+func TestDeclareRetryFlags(t *testing.T) {
+	cfg := config.New()
+	cfg.Declare(config.Flag{Name: "verbose", Type: config.Bool})
+
+	if err := DeclareRetryFlags(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.SetTemporarily(RetryAttemptsKey, "3"); err != nil {
+		t.Error(err)
+	}
+	if err := cfg.SetTemporarily(RetryBackoffKey, "10ms"); err != nil {
+		t.Error(err)
+	}
+	if err := cfg.SetTemporarily(RetryBackoffKey, "soon"); err == nil {
+		t.Error("Expected an error setting a backoff that is not a duration")
+	}
+	if err := DeclareRetryFlags(cfg); err == nil {
+		t.Error("Expected an error declaring the retry flags twice")
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     3,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		300 * time.Millisecond,
+		900 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, expectedBackoff := range expected {
+		if backoff := policy.backoff(i + 1); backoff != expectedBackoff {
+			t.Errorf("Expected %s for retry %d but got %s", expectedBackoff, i+1, backoff)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		backoff := policy.backoff(1)
+		if backoff < 50*time.Millisecond || backoff > 150*time.Millisecond {
+			t.Fatalf("Expected a backoff between 50ms and 150ms but got %s", backoff)
+		}
+	}
+}
+
+type temporaryError struct {
+}
+
+func (te temporaryError) Error() string {
+	return "Temporary error"
+}
+
+func (te temporaryError) Temporary() bool {
+	return true
+}
+
+type flaky struct {
+	failures int
+	err      error
+	attempts int
+}
+
+func (f *flaky) Execute(cfg *config.Config, logger *log.Logger) error {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+type setRetries struct {
+}
+
+func (sr *setRetries) Execute(cfg *config.Config, logger *log.Logger) error {
+	if err := cfg.SetIntTemporarily(RetryAttemptsKey, 4); err != nil {
+		return err
+	}
+	return cfg.SetDurationTemporarily(RetryBackoffKey, 10*time.Millisecond)
+}
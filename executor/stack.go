@@ -0,0 +1,50 @@
+package executor
+
+import (
+	pakelib "github.com/pake-go/pake-lib"
+)
+
+// A Frame describes a block of commands, such as a target or a procedure call, that is being
+// executed.
+type Frame struct {
+	// Name is the name of the block.
+	Name string
+	// Position is where the block appears in the script.
+	Position pakelib.Position
+}
+
+// Block starts a block of commands, such as a target or a procedure call, with the given name
+// and position.  Until the returned function is called, the block is on the call stack given
+// to the commands the Executor executes, and, if the Executor has a Tracer, their spans are
+// children of the block's span, which has the given attributes.  The returned function ends
+// the block with the given error, if any.  Blocks must be ended in the reverse order they were
+// started.
+func (e *Executor) Block(name string, pos pakelib.Position,
+	attrs map[string]string) func(err error) {
+	e.mu.Lock()
+	e.stack = append(e.stack, Frame{Name: name, Position: pos})
+	e.mu.Unlock()
+	endSpan := func(error) {}
+	if e.tracer != nil {
+		spanAttrs := map[string]string{"position": pos.String()}
+		for key, value := range attrs {
+			spanAttrs[key] = value
+		}
+		endSpan = e.tracer.startBlock(name, spanAttrs)
+	}
+	return func(err error) {
+		e.mu.Lock()
+		e.stack = e.stack[:len(e.stack)-1]
+		e.mu.Unlock()
+		endSpan(err)
+	}
+}
+
+// CallStack returns the blocks that have been started but not ended, outermost first.
+func (e *Executor) CallStack() []Frame {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stack := make([]Frame, len(e.stack))
+	copy(stack, e.stack)
+	return stack
+}
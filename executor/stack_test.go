@@ -0,0 +1,39 @@
+package executor
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+func TestBlock_callstack(t *testing.T) {
+	var stacks [][]Frame
+	e := New(log.New(ioutil.Discard, "", 0), WithBeforeCommand(func(inv *Invocation) {
+		stacks = append(stacks, inv.Stack)
+	}))
+	outer := Frame{Name: "target all", Position: pakelib.Position{Line: 1}}
+	inner := Frame{Name: "target build", Position: pakelib.Position{Line: 4}}
+
+	capturer.CaptureOutput(func() {
+		endOuter := e.Block(outer.Name, outer.Position, nil)
+		e.Run([]pakelib.Command{&hello{}}, config.New())
+		endInner := e.Block(inner.Name, inner.Position, nil)
+		e.Run([]pakelib.Command{&bye{}}, config.New())
+		endInner(nil)
+		endOuter(nil)
+		e.Run([]pakelib.Command{&hello{}}, config.New())
+	})
+
+	expectedStacks := [][]Frame{{outer}, {outer, inner}, {}}
+	if !reflect.DeepEqual(stacks, expectedStacks) {
+		t.Errorf("Expected %+v but got %+v", expectedStacks, stacks)
+	}
+	if len(e.CallStack()) != 0 {
+		t.Errorf("Expected an empty call stack but got %+v", e.CallStack())
+	}
+}
@@ -0,0 +1,71 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	pakelib "github.com/pake-go/pake-lib"
+)
+
+// WithStructuredLogger writes a structured record for every command to the given logger, with
+// the file, line and name of the command, how long it took and, if it failed, its error and
+// the kind of its error as attributes.  Errors are written as records instead of being written
+// to the logger and to the output, unless WithOnError was given.  Commands that satisfy
+// pakelib.StructuredCommand are given the structured logger instead of the logger.
+//
+// If New is given a nil logger, commands that only satisfy pakelib.Command are given a logger
+// that writes every line to the structured logger as a record, so they keep working unchanged.
+// With WithConcurrency, the records written by the executor are in the order of the commands,
+// but the records written by the commands themselves are written as soon as they are made.
+func WithStructuredLogger(logger *slog.Logger) Option {
+	return func(e *Executor) {
+		e.structuredLogger = logger
+	}
+}
+
+// logAttrs returns the attributes describing the given position, excluding the file if it is
+// not known.
+func logAttrs(pos pakelib.Position) []slog.Attr {
+	if pos.File == "" {
+		return []slog.Attr{slog.Int("line", pos.Line)}
+	}
+	return []slog.Attr{slog.String("file", pos.File), slog.Int("line", pos.Line)}
+}
+
+// errorKind returns the kind of the given error recorded in the error_kind attribute.
+func errorKind(err error) string {
+	if IsTemporary(err) {
+		return "temporary"
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// logResult writes a record describing how the command of the given invocation finished to the
+// structured logger, if one was given.
+func (e *Executor) logResult(inv *Invocation, err error) {
+	if e.structuredLogger == nil {
+		return
+	}
+	attrs := append(logAttrs(inv.Position),
+		slog.String("command", fmt.Sprintf("%T", inv.Command)),
+		slog.Duration("duration", inv.Duration))
+	if err == nil {
+		e.structuredLogger.LogAttrs(context.Background(), slog.LevelInfo, "command executed",
+			attrs...)
+		return
+	}
+	attrs = append(attrs, slog.String("error", err.Error()), slog.String("error_kind",
+		errorKind(err)))
+	e.structuredLogger.LogAttrs(context.Background(), slog.LevelError, "command failed", attrs...)
+}
+
+// logSkip writes a record describing why the command at the given position was skipped to the
+// structured logger, if one was given.
+func (e *Executor) logSkip(pos pakelib.Position, reason string) {
+	if e.structuredLogger == nil {
+		return
+	}
+	attrs := append(logAttrs(pos), slog.String("reason", reason))
+	e.structuredLogger.LogAttrs(context.Background(), slog.LevelInfo, "command skipped", attrs...)
+}
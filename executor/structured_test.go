@@ -0,0 +1,130 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+type greet struct{}
+
+func (g *greet) Execute(cfg *config.Config, logger *log.Logger) error {
+	logger.Println("Hello from Execute")
+	return nil
+}
+
+func (g *greet) ExecuteStructured(cfg *config.Config, logger *slog.Logger) error {
+	logger.Info("Hello from ExecuteStructured", "name", "pake")
+	return nil
+}
+
+type legacyLogger struct{}
+
+func (l *legacyLogger) Execute(cfg *config.Config, logger *log.Logger) error {
+	logger.Println("Hello from a log.Logger")
+	return nil
+}
+
+// decodeRecords decodes the JSON records written to the given buffer.
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestWithStructuredLogger_records(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	output := capturer.CaptureOutput(func() {
+		New(nil, WithStructuredLogger(logger), WithFilename("pakefile")).Run(
+			[]pakelib.Command{&hello{}, &byeError{}}, config.New())
+	})
+
+	if output != "Hello\n" {
+		t.Errorf("Expected %s but got %s", "Hello\n", output)
+	}
+	records := decodeRecords(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records but got %d: %s", len(records), buf.String())
+	}
+	expected := []map[string]interface{}{
+		{"level": "INFO", "msg": "command executed", "file": "pakefile", "line": 1.0,
+			"command": "*executor.hello"},
+		{"level": "ERROR", "msg": "command failed", "file": "pakefile", "line": 2.0,
+			"command": "*executor.byeError", "error": "Error from bye",
+			"error_kind": "*errors.errorString"},
+	}
+	for i, record := range records {
+		for key, value := range expected[i] {
+			if record[key] != value {
+				t.Errorf("Expected %s of record %d to be %v but got %v", key, i, value,
+					record[key])
+			}
+		}
+		if _, ok := record["duration"]; !ok {
+			t.Errorf("Expected record %d to have a duration", i)
+		}
+	}
+}
+
+func TestWithStructuredLogger_structuredcommand(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	New(nil, WithStructuredLogger(logger)).Run([]pakelib.Command{&greet{}}, config.New())
+
+	records := decodeRecords(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records but got %d: %s", len(records), buf.String())
+	}
+	if records[0]["msg"] != "Hello from ExecuteStructured" || records[0]["name"] != "pake" {
+		t.Errorf("Unexpected record from the command: %v", records[0])
+	}
+}
+
+func TestWithStructuredLogger_logloggeradapter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	New(nil, WithStructuredLogger(logger)).Run([]pakelib.Command{&legacyLogger{}}, config.New())
+
+	records := decodeRecords(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records but got %d: %s", len(records), buf.String())
+	}
+	if records[0]["msg"] != "Hello from a log.Logger" {
+		t.Errorf("Unexpected record from the command: %v", records[0])
+	}
+}
+
+func TestWithStructuredLogger_onerror(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	var errs []string
+
+	New(nil, WithStructuredLogger(logger), WithOnError(func(inv *Invocation, err error) {
+		errs = append(errs, fmt.Sprintf("%s: %s", inv.Position, err.Error()))
+	})).Run([]pakelib.Command{&byeError{}}, config.New())
+
+	if len(errs) != 1 || errs[0] != "line 1: Error from bye" {
+		t.Errorf("Unexpected errors passed to the OnError hook: %q", errs)
+	}
+	if records := decodeRecords(t, &buf); len(records) != 1 {
+		t.Errorf("Expected 1 record but got %d: %s", len(records), buf.String())
+	}
+}
@@ -0,0 +1,243 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pake-go/pake-lib/config"
+)
+
+// A Span describes a command or a block of commands that was executed.
+type Span struct {
+	// ID identifies the span within its Tracer, starting at 1.
+	ID int `json:"id"`
+	// Parent is the ID of the block the span was executed in, or 0 if there is none.
+	Parent int `json:"parent,omitempty"`
+	// Name is the name of the block or the type of the command.
+	Name string `json:"name"`
+	// Category is "block" for blocks of commands and "command" for commands.
+	Category string `json:"category"`
+	// Start is when the span started.
+	Start time.Time `json:"start"`
+	// Duration is how long the span took.
+	Duration time.Duration `json:"duration"`
+	// Attributes describes the span, such as the position and arguments of a command and
+	// the changes it made to the Config.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Error is the error the span ended with, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// end returns when the span ended.
+func (s Span) end() time.Time {
+	return s.Start.Add(s.Duration)
+}
+
+// A Tracer records a span for every command executed by the Executors it is given to and for
+// every block started with Executor.Block.  A Tracer is safe for concurrent use by multiple
+// goroutines.
+type Tracer struct {
+	// Guards every field below.
+	mu sync.Mutex
+	// Represents the spans that have ended, in the order they ended.
+	spans []Span
+	// Represents the ID given to the next span.
+	nextID int
+	// Represents the IDs of the blocks that have started but not ended, outermost first.
+	blocks []int
+	// Represents the function used to get the current time.
+	now func() time.Time
+}
+
+// NewTracer returns a Tracer without any spans.
+func NewTracer() *Tracer {
+	return &Tracer{nextID: 1, now: time.Now}
+}
+
+// WithTracer records a span for every command executed by the Executor in the given Tracer.
+func WithTracer(t *Tracer) Option {
+	return func(e *Executor) {
+		e.tracer = t
+	}
+}
+
+// start begins a span with the given name and category whose parent is the innermost block that
+// has not ended.  It returns the span and the function that ends it.
+func (t *Tracer) start(name, category string, attrs map[string]string) (*Span, func(error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &Span{ID: t.nextID, Name: name, Category: category, Start: t.now(), Attributes: attrs}
+	t.nextID++
+	if len(t.blocks) != 0 {
+		span.Parent = t.blocks[len(t.blocks)-1]
+	}
+	return span, func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		span.Duration = t.now().Sub(span.Start)
+		if err != nil {
+			span.Error = err.Error()
+		}
+		t.spans = append(t.spans, *span)
+	}
+}
+
+// startBlock is the same as start but also makes the span the parent of the spans started
+// before it ends.
+func (t *Tracer) startBlock(name string, attrs map[string]string) func(error) {
+	span, end := t.start(name, "block", attrs)
+	t.mu.Lock()
+	t.blocks = append(t.blocks, span.ID)
+	t.mu.Unlock()
+	return func(err error) {
+		t.mu.Lock()
+		for i := len(t.blocks) - 1; i >= 0; i-- {
+			if t.blocks[i] == span.ID {
+				t.blocks = append(t.blocks[:i], t.blocks[i+1:]...)
+				break
+			}
+		}
+		t.mu.Unlock()
+		end(err)
+	}
+}
+
+// Spans returns the spans that have ended, sorted by when they started.
+func (t *Tracer) Spans() []Span {
+	t.mu.Lock()
+	spans := make([]Span, len(t.spans))
+	copy(spans, t.spans)
+	t.mu.Unlock()
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].Start.Equal(spans[j].Start) {
+			return spans[i].ID < spans[j].ID
+		}
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	return spans
+}
+
+// WriteJSON writes the spans that have ended to the given writer as a JSON array.
+func (t *Tracer) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t.Spans())
+}
+
+// A chromeEvent is a complete event in the Chrome trace-event format.
+type chromeEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat"`
+	Phase     string            `json:"ph"`
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur"`
+	Process   int               `json:"pid"`
+	Thread    int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// WriteChromeTrace writes the spans that have ended to the given writer in the Chrome
+// trace-event format, so that a run can be inspected offline with a browser's trace viewer
+// such as chrome://tracing or Perfetto.  Timestamps are relative to the first span.  Spans
+// that overlap without one containing the other, such as commands executed with
+// WithConcurrency, are shown on separate threads.
+func (t *Tracer) WriteChromeTrace(w io.Writer) error {
+	spans := t.Spans()
+	events := make([]chromeEvent, 0, len(spans))
+	var lanes [][]Span
+	for _, span := range spans {
+		lane := laneFor(lanes, span)
+		if lane == len(lanes) {
+			lanes = append(lanes, nil)
+		}
+		lanes[lane] = append(lanes[lane], span)
+		args := make(map[string]string, len(span.Attributes)+1)
+		for key, value := range span.Attributes {
+			args[key] = value
+		}
+		if span.Error != "" {
+			args["error"] = span.Error
+		}
+		events = append(events, chromeEvent{
+			Name:      span.Name,
+			Category:  span.Category,
+			Phase:     "X",
+			Timestamp: span.Start.Sub(spans[0].Start).Microseconds(),
+			Duration:  span.Duration.Microseconds(),
+			Process:   1,
+			Thread:    lane + 1,
+			Args:      args,
+		})
+	}
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+}
+
+// laneFor returns the first lane the given span can be shown on without overlapping a span
+// that does not contain it, or len(lanes) if there is none.  The spans in each lane are
+// ordered by when they started.
+func laneFor(lanes [][]Span, span Span) int {
+	for i, lane := range lanes {
+		fits := true
+		for _, other := range lane {
+			if other.end().After(span.Start) && other.end().Before(span.end()) {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return i
+		}
+	}
+	return len(lanes)
+}
+
+// trace starts the span of the command of the given invocation if the Executor has a Tracer.
+// The returned function ends the span with the given error and records the changes the command
+// made to the Config.
+func (e *Executor) trace(inv *Invocation) func(err error) {
+	if e.tracer == nil {
+		return func(error) {}
+	}
+	attrs := map[string]string{
+		"position": inv.Position.String(),
+		"args":     strings.TrimPrefix(fmt.Sprintf("%+v", inv.Command), "&"),
+	}
+	before := inv.Config.All()
+	_, end := e.tracer.start(fmt.Sprintf("%T", inv.Command), "command", attrs)
+	return func(err error) {
+		if changes := configChanges(before, inv.Config.All()); changes != "" {
+			attrs["config"] = changes
+		}
+		end(err)
+	}
+}
+
+// configChanges describes every entry in after that differs from the entry of the same key in
+// before, or returns an empty string if there is none.
+func configChanges(before, after []config.Entry) string {
+	previous := make(map[string]config.Entry, len(before))
+	for _, entry := range before {
+		previous[entry.Key] = entry
+	}
+	var changes []string
+	for _, entry := range after {
+		if entry.Value != previous[entry.Key].Value {
+			changes = append(changes, fmt.Sprintf("%s=%q", entry.Key, entry.Value))
+		}
+		delete(previous, entry.Key)
+	}
+	for _, entry := range before {
+		if _, ok := previous[entry.Key]; ok {
+			changes = append(changes, fmt.Sprintf("%s unset", entry.Key))
+		}
+	}
+	return strings.Join(changes, ", ")
+}
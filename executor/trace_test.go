@@ -0,0 +1,121 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// newFakeTracer returns a Tracer whose clock advances by a millisecond every time it is read.
+func newFakeTracer() *Tracer {
+	tracer := NewTracer()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracer.now = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+	return tracer
+}
+
+func TestWithTracer_spans(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	tracer := newFakeTracer()
+	e := New(logger, WithTracer(tracer), WithFilename("pakefile"))
+
+	capturer.CaptureOutput(func() {
+		end := e.Block("target build", pakelib.Position{}, nil)
+		e.Run([]pakelib.Command{&setVerbose{args: []string{"on"}}, &byeError{}}, config.New())
+		end(nil)
+	})
+
+	spans := tracer.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans but got %d: %+v", len(spans), spans)
+	}
+	block, setSpan, byeSpan := spans[0], spans[1], spans[2]
+	if block.Name != "target build" || block.Category != "block" || block.Parent != 0 {
+		t.Errorf("Unexpected block span: %+v", block)
+	}
+	expectedAttributes := map[string]string{
+		"position": "pakefile:1",
+		"args":     "{args:[on]}",
+		"config":   `verbose="true"`,
+	}
+	if !reflect.DeepEqual(setSpan.Attributes, expectedAttributes) {
+		t.Errorf("Expected %+q but got %+q", expectedAttributes, setSpan.Attributes)
+	}
+	if setSpan.Name != "*executor.setVerbose" || setSpan.Parent != block.ID {
+		t.Errorf("Unexpected command span: %+v", setSpan)
+	}
+	if byeSpan.Error != "Error from bye" || byeSpan.Duration != time.Millisecond {
+		t.Errorf("Unexpected command span: %+v", byeSpan)
+	}
+	if block.Start.After(setSpan.Start) || block.end().Before(byeSpan.end()) {
+		t.Errorf("Expected the block %+v to contain its commands", block)
+	}
+}
+
+func TestBlock_notracer(t *testing.T) {
+	e := New(log.New(ioutil.Discard, "", 0))
+
+	e.Block("target build", pakelib.Position{}, nil)(errors.New("Should be ignored"))
+}
+
+func TestWriteChromeTrace(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracer := NewTracer()
+	tracer.spans = []Span{
+		{ID: 1, Name: "block", Category: "block", Start: start, Duration: 10 * time.Millisecond},
+		{ID: 2, Parent: 1, Name: "a", Category: "command", Start: start,
+			Duration: 4 * time.Millisecond},
+		{ID: 3, Parent: 1, Name: "b", Category: "command", Start: start.Add(time.Millisecond),
+			Duration: 4 * time.Millisecond, Error: "failed"},
+	}
+
+	var buf bytes.Buffer
+	if err := tracer.WriteChromeTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatal(err)
+	}
+	expectedEvents := []chromeEvent{
+		{Name: "block", Category: "block", Phase: "X", Duration: 10000, Process: 1, Thread: 1},
+		{Name: "a", Category: "command", Phase: "X", Duration: 4000, Process: 1, Thread: 1},
+		{Name: "b", Category: "command", Phase: "X", Timestamp: 1000, Duration: 4000, Process: 1,
+			Thread: 2, Args: map[string]string{"error": "failed"}},
+	}
+	if !reflect.DeepEqual(trace.TraceEvents, expectedEvents) {
+		t.Errorf("Expected %+v but got %+v", expectedEvents, trace.TraceEvents)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	tracer := newFakeTracer()
+	_, end := tracer.start("hello", "command", map[string]string{"position": "line 1"})
+	end(nil)
+
+	var buf bytes.Buffer
+	if err := tracer.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var spans []Span
+	if err := json.Unmarshal(buf.Bytes(), &spans); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(spans, tracer.Spans()) {
+		t.Errorf("Expected %+v but got %+v", tracer.Spans(), spans)
+	}
+}
@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// An Undo describes the attempt to undo a command during a rollback.
+type Undo struct {
+	// Position is the position of the command.
+	Position pakelib.Position
+	// Command is the type of the command.
+	Command string
+	// Err is the error returned by the command's Undo, or an error saying that the command
+	// can't be undone if it does not implement pakelib.Undoer.  It is nil if the command was
+	// undone.
+	Err error
+}
+
+// A Rollback describes how a transaction was rolled back after a command failed.
+type Rollback struct {
+	// Failed is the position of the command that failed.
+	Failed pakelib.Position
+	// Err is the error returned by the command that failed.
+	Err error
+	// Undos describes the attempt to undo every command executed before the failed one, in
+	// the order they were undone.
+	Undos []Undo
+}
+
+// Complete checks to see if every command executed before the failed one was undone.
+func (r *Rollback) Complete() bool {
+	for _, undo := range r.Undos {
+		if undo.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// WithTransaction executes the commands given to each call of Run or RunAt as a transaction,
+// or the commands given to every call between Begin and Commit: once a command fails, the
+// remaining commands are not executed, the commands executed before it are undone in the
+// reverse order and the Config is restored to its state when the transaction began.  Commands
+// are undone with pakelib.Undoer and are given a copy of the Config in the state they were
+// executed with; the failed command itself and commands skipped because their outputs are up
+// to date are not undone.  Commands are executed one at a time, even with WithConcurrency.
+func WithTransaction() Option {
+	return func(e *Executor) {
+		e.transaction = true
+	}
+}
+
+// A transaction holds what is needed to roll back the commands executed since it began.
+type transaction struct {
+	// Represents the state of the Config when the transaction began.
+	initial config.State
+	// Represents the commands executed so far, in the order they were executed.
+	executed []executedCommand
+}
+
+// An executedCommand is a command executed during a transaction.
+type executedCommand struct {
+	// Represents the invocation of the command.
+	inv *Invocation
+	// Represents the state of the Config the command was executed with.
+	state config.State
+}
+
+// Begin starts a transaction spanning every following call of Run and RunAt until Commit is
+// called, so that once a command fails the commands executed by the earlier calls are undone
+// as well and the Config is restored to its state when Begin was called.  It has no effect
+// without WithTransaction.  Begin and Commit must not be called while commands are executed.
+func (e *Executor) Begin(cfg *config.Config) {
+	if e.transaction {
+		e.tx = &transaction{initial: cfg.State()}
+	}
+}
+
+// Commit ends the transaction started by Begin, so that the commands executed since then are
+// no longer undone once a command fails.
+func (e *Executor) Commit() {
+	e.tx = nil
+}
+
+// Rollbacks returns the rollbacks made by the executor so far, in the order they were made.
+func (e *Executor) Rollbacks() []Rollback {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Rollback{}, e.rollbacks...)
+}
+
+// WriteRollbackReport writes every rollback made so far to w, with a line for each command
+// that was or could not be undone.
+func (e *Executor) WriteRollbackReport(w io.Writer) error {
+	for _, rollback := range e.Rollbacks() {
+		_, err := fmt.Fprintf(w, "Rolled back after %s failed: %s\n", rollback.Failed,
+			rollback.Err.Error())
+		if err != nil {
+			return err
+		}
+		for _, undo := range rollback.Undos {
+			if undo.Err == nil {
+				_, err = fmt.Fprintf(w, "  Undid %s (%s)\n", undo.Position, undo.Command)
+			} else {
+				_, err = fmt.Fprintf(w, "  Can't undo %s (%s): %s\n", undo.Position,
+					undo.Command, undo.Err.Error())
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runTransaction executes the commands one at a time and rolls back the commands executed so
+// far in the transaction started by Begin, or in this call if there is none, once one of them
+// fails.  It returns a *CommandError for the command that failed, if any.
+func (e *Executor) runTransaction(commands []pakelib.Command, positions []pakelib.Position,
+	cfg *config.Config) error {
+	tx := e.tx
+	if tx == nil {
+		tx = &transaction{initial: cfg.State()}
+	}
+	for i, command := range commands {
+		state := cfg.State()
+		inv, err := e.execute(positions[i], command, cfg)
+		if err != nil {
+			e.rollback(tx, inv, err)
+			return failure(positions[i], err)
+		}
+		if inv != nil {
+			tx.executed = append(tx.executed, executedCommand{inv: inv, state: state})
+		}
+	}
+	return nil
+}
+
+// rollback undoes the commands executed in the given transaction in the reverse order after
+// the command of the given invocation failed with the given error and restores the Config to
+// its state when the transaction began.
+func (e *Executor) rollback(tx *transaction, failed *Invocation, err error) {
+	rollback := Rollback{Failed: failed.Position, Err: err}
+	for i := len(tx.executed) - 1; i >= 0; i-- {
+		inv := tx.executed[i].inv
+		if _, ok := inv.Command.(*pakelib.Comment); ok {
+			continue
+		}
+		undo := Undo{Position: inv.Position, Command: fmt.Sprintf("%T", inv.Command)}
+		if undoer, ok := inv.Command.(pakelib.Undoer); ok {
+			cfg := failed.Config.Clone()
+			undo.Err = cfg.SetState(tx.executed[i].state)
+			if undo.Err == nil {
+				undo.Err = undoer.Undo(cfg, e.logger)
+			}
+		} else {
+			undo.Err = fmt.Errorf("%s does not implement Undo", undo.Command)
+		}
+		if undo.Err != nil {
+			e.logger.Printf("Can't undo the command at %s: %s", inv.Position,
+				undo.Err.Error())
+		}
+		rollback.Undos = append(rollback.Undos, undo)
+	}
+	if err := failed.Config.SetState(tx.initial); err != nil {
+		e.logger.Printf("Can't restore the Config: %s", err.Error())
+	}
+	tx.executed = nil
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rollbacks = append(e.rollbacks, rollback)
+}
@@ -0,0 +1,207 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+
+	capturer "github.com/kami-zh/go-capturer"
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+)
+
+// An appendItem appends an item to a list and removes it when undone.
+type appendItem struct {
+	item   string
+	list   *[]string
+	broken bool
+}
+
+func (ai *appendItem) Execute(cfg *config.Config, logger *log.Logger) error {
+	*ai.list = append(*ai.list, ai.item)
+	return nil
+}
+
+func (ai *appendItem) Undo(cfg *config.Config, logger *log.Logger) error {
+	if ai.broken {
+		return errors.New("Can't remove " + ai.item)
+	}
+	for i, item := range *ai.list {
+		if item == ai.item {
+			*ai.list = append((*ai.list)[:i], (*ai.list)[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func TestWithTransaction_rollback(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var list []string
+	cfg := config.New()
+	cfg.SetPermanently("color", "red")
+	e := New(logger, WithTransaction())
+
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{
+			&appendItem{item: "a", list: &list},
+			&setColor{},
+			&pakelib.Comment{},
+			&hello{},
+			&appendItem{item: "b", list: &list},
+			&byeError{},
+			&appendItem{item: "c", list: &list},
+		}, cfg)
+	})
+
+	if len(list) != 0 {
+		t.Errorf("Expected every item to be removed but got %+q", list)
+	}
+	expectedEntries := []config.Entry{{Key: "color", Value: "red", Provenance: config.Permanent}}
+	if !reflect.DeepEqual(cfg.All(), expectedEntries) {
+		t.Errorf("Expected %+v but got %+v", expectedEntries, cfg.All())
+	}
+	rollbacks := e.Rollbacks()
+	if len(rollbacks) != 1 {
+		t.Fatalf("Expected 1 rollback but got %+v", rollbacks)
+	}
+	if rollbacks[0].Complete() {
+		t.Error("Expected the rollback to be incomplete")
+	}
+
+	var buf bytes.Buffer
+	if err := e.WriteRollbackReport(&buf); err != nil {
+		t.Error(err)
+	}
+	expectedReport := "Rolled back after line 6 failed: Error from bye\n" +
+		"  Undid line 5 (*executor.appendItem)\n" +
+		"  Can't undo line 4 (*executor.hello): *executor.hello does not implement Undo\n" +
+		"  Can't undo line 2 (*executor.setColor): *executor.setColor does not implement Undo\n" +
+		"  Undid line 1 (*executor.appendItem)\n"
+	if buf.String() != expectedReport {
+		t.Errorf("Expected %s but got %s", expectedReport, buf.String())
+	}
+}
+
+func TestWithTransaction_failedundo(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	var list []string
+	e := New(logger, WithTransaction())
+
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{
+			&appendItem{item: "a", list: &list},
+			&appendItem{item: "b", list: &list, broken: true},
+			&byeError{},
+		}, config.New())
+	})
+
+	expectedList := []string{"b"}
+	if !reflect.DeepEqual(list, expectedList) {
+		t.Errorf("Expected %+q but got %+q", expectedList, list)
+	}
+	expectedLogOutput := "There was an error at line 3: Error from bye\n" +
+		"Can't undo the command at line 2: Can't remove b\n"
+	if logOutput.String() != expectedLogOutput {
+		t.Errorf("Expected %s but got %s", expectedLogOutput, logOutput.String())
+	}
+}
+
+func TestWithTransaction_success(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var list []string
+	e := New(logger, WithTransaction())
+
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{
+			&appendItem{item: "a", list: &list},
+			&appendItem{item: "b", list: &list},
+		}, config.New())
+	})
+
+	expectedList := []string{"a", "b"}
+	if !reflect.DeepEqual(list, expectedList) {
+		t.Errorf("Expected %+q but got %+q", expectedList, list)
+	}
+	if len(e.Rollbacks()) != 0 {
+		t.Errorf("Expected no rollbacks but got %+v", e.Rollbacks())
+	}
+}
+
+// A colorUndoer records the color it is undone with.
+type colorUndoer struct {
+	colors *[]string
+}
+
+func (cu *colorUndoer) Execute(cfg *config.Config, logger *log.Logger) error {
+	return nil
+}
+
+func (cu *colorUndoer) Undo(cfg *config.Config, logger *log.Logger) error {
+	color, _ := cfg.Get("color")
+	*cu.colors = append(*cu.colors, color)
+	return nil
+}
+
+func TestWithTransaction_undoconfig(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var colors []string
+	cfg := config.New()
+	cfg.SetPermanently("color", "red")
+	history := config.NewHistory(cfg)
+	e := New(logger, WithTransaction())
+
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{
+			&colorUndoer{colors: &colors},
+			&setter{key: "color", value: "blue"},
+			&colorUndoer{colors: &colors},
+			&byeError{},
+		}, cfg)
+	})
+
+	expectedColors := []string{"blue", "red"}
+	if !reflect.DeepEqual(colors, expectedColors) {
+		t.Errorf("Expected %+q but got %+q", expectedColors, colors)
+	}
+	changes := history.Changes("color")
+	last := changes[len(changes)-1]
+	if last.Cause != config.CauseRestore || last.Old != "blue" || last.New != "red" {
+		t.Errorf("Expected the restored color to be published but got %+v", changes)
+	}
+}
+
+func TestBegin(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	var list []string
+	cfg := config.New()
+	e := New(logger, WithTransaction())
+
+	e.Begin(cfg)
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{&appendItem{item: "a", list: &list}}, cfg)
+		e.Run([]pakelib.Command{&setColor{}, &appendItem{item: "b", list: &list}}, cfg)
+		e.Run([]pakelib.Command{&byeError{}}, cfg)
+	})
+	e.Commit()
+
+	if len(list) != 0 {
+		t.Errorf("Expected every item to be removed but got %+q", list)
+	}
+	if entries := cfg.All(); len(entries) != 0 {
+		t.Errorf("Expected the Config to be restored but got %+v", entries)
+	}
+
+	capturer.CaptureOutput(func() {
+		e.Run([]pakelib.Command{&appendItem{item: "c", list: &list}}, cfg)
+		e.Run([]pakelib.Command{&byeError{}}, cfg)
+	})
+	expectedList := []string{"c"}
+	if !reflect.DeepEqual(list, expectedList) {
+		t.Errorf("Expected %+q but got %+q", expectedList, list)
+	}
+}
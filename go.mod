@@ -1,9 +1,14 @@
 module github.com/pake-go/pake-lib
 
-go 1.14
+go 1.21
 
 require (
 	github.com/PGo-Projects/output v0.0.0-20200331004504-59c843518d91
 	github.com/google/go-cmp v0.2.0
 	github.com/kami-zh/go-capturer v0.0.0-20171211120116-e492ea43421d
 )
+
+require (
+	github.com/buger/goterm v0.0.0-20181115115552-c206103e1f37 // indirect
+	golang.org/x/sys v0.0.0-20190626221950-04f50cda93cb // indirect
+)
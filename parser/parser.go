@@ -3,9 +3,12 @@
 package parser
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"strings"
 
 	pakelib "github.com/pake-go/pake-lib"
@@ -19,8 +22,22 @@ type Parser struct {
 	commandCandidates []pakelib.CommandCandidate
 	// Represents the function used to check if a string is a valid comment.
 	commentValidator pakelib.CommentValidator
+	// Represents the structured logger errors are written to instead of the given logger.
+	structuredLogger *slog.Logger
 }
 
+// The kinds of errors recorded in the error_kind attribute of structured log records.
+const (
+	// ReadErrorKind is the kind of errors encountered while reading a script.
+	ReadErrorKind = "read"
+	// SyntaxErrorKind is the kind of errors encountered while splitting a line into tokens.
+	SyntaxErrorKind = "syntax"
+	// InvalidArgsErrorKind is the kind of errors returned by a command's validator.
+	InvalidArgsErrorKind = "invalid_args"
+	// UnknownCommandErrorKind is the kind of errors for lines no command can handle.
+	UnknownCommandErrorKind = "unknown_command"
+)
+
 // New returns a parser for converting source files and strings into a list of commands.
 func New(cmdCandidates []pakelib.CommandCandidate, cv pakelib.CommentValidator) *Parser {
 	return &Parser{
@@ -29,28 +46,60 @@ func New(cmdCandidates []pakelib.CommandCandidate, cv pakelib.CommentValidator)
 	}
 }
 
+// SetStructuredLogger makes the parser write errors to the given structured logger instead of
+// the logger passed to each Parse function.  Every error is written as one record with the
+// file, line, command name and kind of the error as attributes.  The logger passed to each
+// Parse function may be nil once a structured logger has been set.
+func (p *Parser) SetStructuredLogger(logger *slog.Logger) {
+	p.structuredLogger = logger
+}
+
 // ParseFile takes in a filename and parses the content of the file to return a list of commands
 // that can be run by executor.Run along with any errors that were encountered.
 func (p *Parser) ParseFile(filename string, logger *log.Logger) ([]pakelib.Command, error) {
 	fileContent, err := ioutil.ReadFile(filename)
 	if err != nil {
-		logger.Println(err.Error())
+		p.LogError(logger, err, ReadErrorKind, slog.String("file", filename))
+		return []pakelib.Command{}, err
+	}
+	return p.parse(filename, string(fileContent), logger)
+}
+
+// ParseFS takes in a filesystem and the name of a file within it and parses the content of the
+// file to return a list of commands that can be run by executor.Run along with any errors that
+// were encountered.  This allows scripts to be loaded from an embed.FS, a zip archive or an
+// in-memory filesystem.
+func (p *Parser) ParseFS(fsys fs.FS, name string, logger *log.Logger) ([]pakelib.Command, error) {
+	fileContent, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		p.LogError(logger, err, ReadErrorKind, slog.String("file", name))
 		return []pakelib.Command{}, err
 	}
-	return p.ParseString(string(fileContent), logger)
+	return p.parse(name, string(fileContent), logger)
 }
 
 // ParseString takes in a string and parses it to return a list of commands that can be run by
 // executor.Run along with any errors that was encountered.
 func (p *Parser) ParseString(str string, logger *log.Logger) ([]pakelib.Command, error) {
+	return p.parse("", str, logger)
+}
+
+// parse converts the given string into a list of commands.  The name of the file the string was
+// read from is included in error messages if it is not empty.
+func (p *Parser) parse(name, str string, logger *log.Logger) ([]pakelib.Command, error) {
 	var commands []pakelib.Command
-	silentLogger := log.New(ioutil.Discard, "", log.LstdFlags)
 	lines := strings.Split(str, "\n")
 	for linenum, line := range lines {
-		command, err := p.ParseLine(line, silentLogger)
+		command, kind, err := p.ParseLineKind(line)
 		if err != nil {
-			errMsg := fmt.Errorf("An error occured on line %d: %s", linenum+1, err.Error())
-			logger.Println(errMsg.Error())
+			var errMsg error
+			if name == "" {
+				errMsg = fmt.Errorf("An error occured on line %d: %s", linenum+1, err.Error())
+			} else {
+				errMsg = fmt.Errorf("An error occured in %s on line %d: %s", name, linenum+1,
+					err.Error())
+			}
+			p.LogError(logger, errMsg, kind, LineAttrs(name, linenum+1, line)...)
 			return []pakelib.Command{}, errMsg
 		}
 		commands = append(commands, command)
@@ -58,18 +107,57 @@ func (p *Parser) ParseString(str string, logger *log.Logger) ([]pakelib.Command,
 	return commands, nil
 }
 
+// LineAttrs returns the attributes of structured log records describing the given line: its
+// number, the name of the file it is in if it is not empty and the command it names, if any.
+func LineAttrs(name string, linenum int, line string) []slog.Attr {
+	attrs := []slog.Attr{slog.Int("line", linenum)}
+	if name != "" {
+		attrs = append(attrs, slog.String("file", name))
+	}
+	return append(attrs, commandAttrs(line)...)
+}
+
+// commandAttrs returns the attribute naming the command of the given line, if it has one.
+func commandAttrs(line string) []slog.Attr {
+	if tokens, err := argutil.GetTokens(line); err == nil && len(tokens) != 0 {
+		return []slog.Attr{slog.String("command", tokens[0])}
+	}
+	return nil
+}
+
+// LogError writes the given error to the structured logger with the given kind and
+// attributes if one has been set, or to the given logger otherwise.  This allows packages
+// that parse scripts with ParseLineKind to report errors the same way the parser does.
+func (p *Parser) LogError(logger *log.Logger, err error, kind string, attrs ...slog.Attr) {
+	if p.structuredLogger == nil {
+		logger.Println(err.Error())
+		return
+	}
+	attrs = append(attrs, slog.String("error", err.Error()), slog.String("error_kind", kind))
+	p.structuredLogger.LogAttrs(context.Background(), slog.LevelError, "parse failed", attrs...)
+}
+
 // ParseLine takes a string that represent one line of code in the language and parses it to
 // return a list of commands that can be run by executor.Run along with any errors that were
 // encountered.
 func (p *Parser) ParseLine(line string, logger *log.Logger) (pakelib.Command, error) {
+	command, kind, err := p.ParseLineKind(line)
+	if err != nil {
+		p.LogError(logger, err, kind, commandAttrs(line)...)
+	}
+	return command, err
+}
+
+// ParseLineKind is the same as ParseLine but returns the kind of the error, if any, instead of
+// logging the error.
+func (p *Parser) ParseLineKind(line string) (pakelib.Command, string, error) {
 	if p.commentValidator.IsValid(line) {
-		return &pakelib.Comment{}, nil
+		return &pakelib.Comment{}, "", nil
 	}
 
 	tokens, err := argutil.GetTokens(line)
 	if err != nil {
-		logger.Println(err.Error())
-		return nil, err
+		return nil, SyntaxErrorKind, err
 	}
 	args := tokens[1:len(tokens)]
 	for _, cmdCandidate := range p.commandCandidates {
@@ -78,13 +166,10 @@ func (p *Parser) ParseLine(line string, logger *log.Logger) (pakelib.Command, er
 			err := validator.ValidateArgs(args)
 			if err == nil {
 				constructor := cmdCandidate.Constructor
-				return constructor(args), nil
+				return constructor(args), "", nil
 			}
-			logger.Println(err.Error())
-			return nil, err
+			return nil, InvalidArgsErrorKind, err
 		}
 	}
-	errMsg := fmt.Errorf("%s is not a valid command", tokens[0])
-	logger.Println(errMsg.Error())
-	return nil, errMsg
+	return nil, UnknownCommandErrorKind, fmt.Errorf("%s is not a valid command", tokens[0])
 }
@@ -1,12 +1,16 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/google/go-cmp/cmp"
 	pakelib "github.com/pake-go/pake-lib"
@@ -67,6 +71,69 @@ func TestParseFile_witherror(t *testing.T) {
 	}
 }
 
+func TestParseFS_noerror(t *testing.T) {
+	commandCandidates := []pakelib.CommandCandidate{
+		helloCandidate,
+		byeCandidate,
+	}
+	cv := &commentValidator{}
+	fsys := fstest.MapFS{
+		"scripts/pakefile": &fstest.MapFile{Data: []byte("hello \n# comment\nbye ")},
+	}
+	logger := log.New(ioutil.Discard, "", 0)
+
+	parser := New(commandCandidates, cv)
+	command, err := parser.ParseFS(fsys, "scripts/pakefile", logger)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []pakelib.Command{
+		&hello{Args: []string{""}},
+		&pakelib.Comment{},
+		&bye{Args: []string{""}},
+	}
+	if !cmp.Equal(command, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, command)
+	}
+}
+
+func TestParseFS_witherror(t *testing.T) {
+	commandCandidates := []pakelib.CommandCandidate{
+		helloCandidate,
+		byeWithErrorCandidate,
+	}
+	cv := &commentValidator{}
+	fsys := fstest.MapFS{
+		"pakefile": &fstest.MapFile{Data: []byte("hello \nbyeWithError ")},
+	}
+	logger := log.New(ioutil.Discard, "", 0)
+
+	parser := New(commandCandidates, cv)
+	_, err := parser.ParseFS(fsys, "pakefile", logger)
+	if err == nil {
+		t.Fatal("There should be an error parsing the given!")
+	}
+	expectedErr := "An error occured in pakefile on line 2: The arg is no good"
+	if err.Error() != expectedErr {
+		t.Errorf("Expected %s but got %s", expectedErr, err.Error())
+	}
+}
+
+func TestParseFS_nonexistentfile(t *testing.T) {
+	commandCandidates := []pakelib.CommandCandidate{
+		helloCandidate,
+	}
+	cv := &commentValidator{}
+	fsys := fstest.MapFS{}
+	logger := log.New(ioutil.Discard, "", 0)
+
+	parser := New(commandCandidates, cv)
+	_, err := parser.ParseFS(fsys, "pakefile", logger)
+	if err == nil {
+		t.Errorf("There should be an error reading a nonexistent file!")
+	}
+}
+
 func TestParseString_noerror(t *testing.T) {
 	commandCandidates := []pakelib.CommandCandidate{
 		helloCandidate,
@@ -238,3 +305,83 @@ var byeWithErrorCandidate = pakelib.CommandCandidate{
 	Validator:   &byeWithErrorValidator{},
 	Constructor: newByeWithError,
 }
+
+func TestSetStructuredLogger(t *testing.T) {
+	commandCandidates := []pakelib.CommandCandidate{
+		helloCandidate,
+		byeWithErrorCandidate,
+	}
+	cv := &commentValidator{}
+	fsys := fstest.MapFS{
+		"pakefile": &fstest.MapFile{Data: []byte("hello \nbyeWithError \nfoo")},
+	}
+	var buf bytes.Buffer
+
+	parser := New(commandCandidates, cv)
+	parser.SetStructuredLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	if _, err := parser.ParseFS(fsys, "pakefile", nil); err == nil {
+		t.Fatal("There should be an error parsing the given!")
+	}
+	record := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"level":      "ERROR",
+		"msg":        "parse failed",
+		"file":       "pakefile",
+		"line":       2.0,
+		"command":    "byeWithError",
+		"error":      "An error occured in pakefile on line 2: The arg is no good",
+		"error_kind": InvalidArgsErrorKind,
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("Expected %s to be %v but got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestSetStructuredLogger_unknowncommand(t *testing.T) {
+	var buf bytes.Buffer
+
+	parser := New([]pakelib.CommandCandidate{helloCandidate}, &commentValidator{})
+	parser.SetStructuredLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	if _, err := parser.ParseString("foo", nil); err == nil {
+		t.Fatal("There should be an error parsing the given!")
+	}
+	record := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["error_kind"] != UnknownCommandErrorKind {
+		t.Errorf("Expected %s but got %v", UnknownCommandErrorKind, record["error_kind"])
+	}
+	if _, ok := record["file"]; ok {
+		t.Errorf("Expected no file but got %v", record["file"])
+	}
+}
+
+func TestSetStructuredLogger_parseline(t *testing.T) {
+	var buf bytes.Buffer
+
+	parser := New([]pakelib.CommandCandidate{helloCandidate}, &commentValidator{})
+	parser.SetStructuredLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	if _, err := parser.ParseLine("foo bar", nil); err == nil {
+		t.Fatal("There should be an error parsing the given!")
+	}
+	record := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"command":    "foo",
+		"error":      "foo is not a valid command",
+		"error_kind": UnknownCommandErrorKind,
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("Expected %v but got %v", value, record[key])
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package pakelib
+
+import "fmt"
+
+// Position represents where a command appears in a script.
+type Position struct {
+	// File is the name of the script, or an empty string if it is not known.
+	File string
+	// Line is the line number of the command, starting at 1.
+	Line int
+}
+
+// String returns the position as "file:line", or as "line N" if the file is not known.
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("line %d", p.Line)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// Positions returns the positions of a list of n commands parsed from the given file with
+// one command per line, as returned by the parser.
+func Positions(file string, n int) []Position {
+	positions := make([]Position, n)
+	for i := range positions {
+		positions[i] = Position{File: file, Line: i + 1}
+	}
+	return positions
+}
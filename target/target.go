@@ -0,0 +1,312 @@
+// Package target provides make-style targets for scripts.  A target is a named block of
+// commands that depends on other targets:
+//
+//	target build: generate
+//	    compile main
+//	end
+//
+// Running a target runs the targets it depends on first, each target at most once.
+package target
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+	"github.com/pake-go/pake-lib/executor"
+	"github.com/pake-go/pake-lib/parser"
+)
+
+const (
+	// Keyword starts a target block and is followed by the target's name and, after a colon,
+	// the names of the targets it depends on.
+	Keyword = "target"
+	// EndKeyword ends a target block.
+	EndKeyword = "end"
+	// ErrorKind is the kind of errors in the structure of the targets of a script, recorded
+	// in the error_kind attribute of the records written to the parser's structured logger.
+	ErrorKind = "target"
+)
+
+// A Target is a named block of commands that depends on other targets.
+type Target struct {
+	// Name is the name of the target.
+	Name string
+	// Dependencies are the names of the targets that must be run before this target.
+	Dependencies []string
+	// Commands are the commands in the target's body.
+	Commands []pakelib.Command
+	// Positions are the positions of the commands in the target's body.
+	Positions []pakelib.Position
+	// Position is the position of the line that starts the target.
+	Position pakelib.Position
+}
+
+// A Graph holds the targets of a script along with the commands outside of any target.
+type Graph struct {
+	// Represents the commands outside of any target, which are run before any target.
+	preamble []pakelib.Command
+	// Represents the positions of the commands outside of any target.
+	preamblePositions []pakelib.Position
+	// Represents the targets keyed by name.
+	targets map[string]*Target
+	// Represents the names of the targets in the order they were declared.
+	names []string
+}
+
+// ParseFile takes in a filename and parses the content of the file into a Graph using the
+// given parser for the commands, along with any errors that were encountered.  Like the
+// parser's own Parse functions, errors are written to the parser's structured logger if it
+// has one, in which case the logger may be nil, or to the given logger otherwise.
+func ParseFile(p *parser.Parser, filename string, logger *log.Logger) (*Graph, error) {
+	fileContent, err := ioutil.ReadFile(filename)
+	if err != nil {
+		p.LogError(logger, err, parser.ReadErrorKind, slog.String("file", filename))
+		return nil, err
+	}
+	return parse(p, filename, string(fileContent), logger)
+}
+
+// ParseFS is the same as ParseFile but reads the file with the given name from the given
+// filesystem.
+func ParseFS(p *parser.Parser, fsys fs.FS, name string, logger *log.Logger) (*Graph, error) {
+	fileContent, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		p.LogError(logger, err, parser.ReadErrorKind, slog.String("file", name))
+		return nil, err
+	}
+	return parse(p, name, string(fileContent), logger)
+}
+
+// ParseString takes in a string and parses it into a Graph using the given parser for the
+// commands, along with any errors that were encountered.
+func ParseString(p *parser.Parser, str string, logger *log.Logger) (*Graph, error) {
+	return parse(p, "", str, logger)
+}
+
+// parse converts the given string into a Graph.  The name of the file the string was read
+// from is included in error messages and positions if it is not empty.  Errors are written to
+// the parser's structured logger if it has one, or to the given logger otherwise.
+func parse(p *parser.Parser, name, str string, logger *log.Logger) (*Graph, error) {
+	g := &Graph{targets: make(map[string]*Target)}
+	var current *Target
+	lines := strings.Split(str, "\n")
+	fail := func(pos pakelib.Position, kind string, err error) error {
+		errMsg := positionError(pos, err)
+		p.LogError(logger, errMsg, kind, parser.LineAttrs(name, pos.Line,
+			lines[pos.Line-1])...)
+		return errMsg
+	}
+	for linenum, line := range lines {
+		pos := pakelib.Position{File: name, Line: linenum + 1}
+		if kind, err := g.parseLine(p, line, pos, &current); err != nil {
+			return nil, fail(pos, kind, err)
+		}
+	}
+	if current != nil {
+		return nil, fail(current.Position, ErrorKind,
+			fmt.Errorf("Target %s is missing %s", current.Name, EndKeyword))
+	}
+	for _, targetName := range g.names {
+		t := g.targets[targetName]
+		for _, dependency := range t.Dependencies {
+			if _, ok := g.targets[dependency]; !ok {
+				return nil, fail(t.Position, ErrorKind,
+					fmt.Errorf("Target %s depends on unknown target %s", t.Name, dependency))
+			}
+		}
+	}
+	return g, nil
+}
+
+// parseLine parses one line of a script, starting, ending or adding to the current target.
+// It returns the kind of the error, if any, along with the error.
+func (g *Graph) parseLine(p *parser.Parser, line string, pos pakelib.Position,
+	current **Target) (string, error) {
+	trimmed := strings.TrimSpace(line)
+	fields := strings.Fields(trimmed)
+	switch {
+	case len(fields) > 0 && fields[0] == Keyword:
+		if *current != nil {
+			return ErrorKind, fmt.Errorf("Target %s is missing %s", (*current).Name, EndKeyword)
+		}
+		t, err := parseHeader(strings.TrimSpace(strings.TrimPrefix(trimmed, Keyword)))
+		if err != nil {
+			return ErrorKind, err
+		}
+		if _, ok := g.targets[t.Name]; ok {
+			return ErrorKind, fmt.Errorf("Target %s has already been declared", t.Name)
+		}
+		t.Position = pos
+		g.targets[t.Name] = t
+		g.names = append(g.names, t.Name)
+		*current = t
+	case trimmed == EndKeyword:
+		if *current == nil {
+			return ErrorKind, fmt.Errorf("%s is outside of a target", EndKeyword)
+		}
+		*current = nil
+	case *current != nil:
+		command, kind, err := p.ParseLineKind(trimmed)
+		if err != nil {
+			return kind, err
+		}
+		(*current).Commands = append((*current).Commands, command)
+		(*current).Positions = append((*current).Positions, pos)
+	default:
+		command, kind, err := p.ParseLineKind(line)
+		if err != nil {
+			return kind, err
+		}
+		g.preamble = append(g.preamble, command)
+		g.preamblePositions = append(g.preamblePositions, pos)
+	}
+	return "", nil
+}
+
+// parseHeader parses the name and dependencies following the target keyword.
+func parseHeader(header string) (*Target, error) {
+	parts := strings.SplitN(header, ":", 2)
+	nameFields := strings.Fields(parts[0])
+	if len(nameFields) != 1 {
+		return nil, fmt.Errorf("Expected %s name: dependencies", Keyword)
+	}
+	t := &Target{Name: nameFields[0]}
+	if len(parts) == 2 {
+		t.Dependencies = strings.Fields(parts[1])
+	}
+	return t, nil
+}
+
+// positionError adds the given position to the given error.
+func positionError(pos pakelib.Position, err error) error {
+	if pos.File == "" {
+		return fmt.Errorf("An error occured on line %d: %s", pos.Line, err.Error())
+	}
+	return fmt.Errorf("An error occured in %s on line %d: %s", pos.File, pos.Line, err.Error())
+}
+
+// Targets returns the targets in the order they were declared.
+func (g *Graph) Targets() []*Target {
+	targets := make([]*Target, len(g.names))
+	for i, name := range g.names {
+		targets[i] = g.targets[name]
+	}
+	return targets
+}
+
+// Positions returns the positions of every command that is not a comment, both outside of any
+// target and in the body of every target, in the order they appear in the script.
+func (g *Graph) Positions() []pakelib.Position {
+	var positions []pakelib.Position
+	add := func(commands []pakelib.Command, commandPositions []pakelib.Position) {
+		for i, command := range commands {
+			if _, ok := command.(*pakelib.Comment); !ok {
+				positions = append(positions, commandPositions[i])
+			}
+		}
+	}
+	add(g.preamble, g.preamblePositions)
+	for _, t := range g.targets {
+		add(t.Commands, t.Positions)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Line < positions[j].Line
+	})
+	return positions
+}
+
+// Target returns the target with the given name and whether it exists.
+func (g *Graph) Target(name string) (*Target, bool) {
+	t, ok := g.targets[name]
+	return t, ok
+}
+
+// Plan returns the targets that must be run to run the given targets, with every target
+// after the targets it depends on and each target at most once.  It returns an error if a
+// target does not exist or if there is a dependency cycle, naming the targets in the cycle.
+func (g *Graph) Plan(names ...string) ([]*Target, error) {
+	var plan []*Target
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		if done[name] {
+			return nil
+		}
+		t, ok := g.targets[name]
+		if !ok {
+			return fmt.Errorf("%s is not a target", name)
+		}
+		if visiting[name] {
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("There is a dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+		visiting[name] = true
+		path = append(path, name)
+		for _, dependency := range t.Dependencies {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		visiting[name] = false
+		done[name] = true
+		plan = append(plan, t)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// Run runs the commands outside of any target followed by the commands of the targets
+// returned by Plan() for the given targets, using the given executor and Config.  It returns
+// an error without running anything if the targets can't be planned.  Like make, it stops once
+// a target has a command that failed, so the targets depending on it are not run, and returns
+// the error of the first command that failed.  Each target is run as a block, so its commands
+// are grouped under it if the executor has a Tracer, and the commands of every target are
+// reachable, so targets that are not run are reported as not covered.  With
+// executor.WithTransaction, the whole run is a single transaction, so a failed command undoes
+// the commands of the targets run before it as well.
+func (g *Graph) Run(e *executor.Executor, cfg *config.Config, names ...string) error {
+	plan, err := g.Plan(names...)
+	if err != nil {
+		return err
+	}
+	e.Begin(cfg)
+	defer e.Commit()
+	for _, t := range g.targets {
+		e.Reachable(t.Commands, t.Positions)
+	}
+	if err := e.RunAt(g.preamble, g.preamblePositions, cfg); err != nil {
+		return err
+	}
+	for _, t := range plan {
+		end := e.Block(Keyword+" "+t.Name, t.Position, nil)
+		err := e.RunAt(t.Commands, t.Positions, cfg)
+		end(err)
+		if errors.Is(err, executor.ErrTerminated) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("Target %s failed: %w", t.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package target
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	pakelib "github.com/pake-go/pake-lib"
+	"github.com/pake-go/pake-lib/config"
+	"github.com/pake-go/pake-lib/executor"
+	"github.com/pake-go/pake-lib/parser"
+)
+
+const script = `# preamble
+say setup
+target all: build test
+end
+target build: generate
+    say build
+end
+target generate
+    say generate
+end
+target test: build
+    # run the tests
+    say test
+end`
+
+func TestParseString_noerror(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+
+	g, err := ParseString(newParser(), script, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, target := range g.Targets() {
+		names = append(names, target.Name)
+	}
+	expectedNames := []string{"all", "build", "generate", "test"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected %+q but got %+q", expectedNames, names)
+	}
+	test, ok := g.Target("test")
+	if !ok {
+		t.Fatal("Expected test to be a target")
+	}
+	expectedDependencies := []string{"build"}
+	if !reflect.DeepEqual(test.Dependencies, expectedDependencies) {
+		t.Errorf("Expected %+q but got %+q", expectedDependencies, test.Dependencies)
+	}
+	expectedPositions := []pakelib.Position{{Line: 12}, {Line: 13}}
+	if !reflect.DeepEqual(test.Positions, expectedPositions) {
+		t.Errorf("Expected %+v but got %+v", expectedPositions, test.Positions)
+	}
+}
+
+func TestParseString_witherror(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	tests := map[string]string{
+		"target a\nsay a":                  "line 1: Target a is missing end",
+		"target a\ntarget b\nend":          "line 2: Target a is missing end",
+		"end":                              "line 1: end is outside of a target",
+		"target a: b\nend":                 "line 1: Target a depends on unknown target b",
+		"target a\nend\ntarget a\nend":     "line 3: Target a has already been declared",
+		"target\nend":                      "line 1: Expected target name: dependencies",
+		"target a\n    unknown thing\nend": "line 2: unknown is not a valid command",
+	}
+	for str, expectedErr := range tests {
+		_, err := ParseString(newParser(), str, logger)
+		if err == nil {
+			t.Errorf("Expected an error parsing %q", str)
+			continue
+		}
+		if !strings.HasSuffix(err.Error(), expectedErr) {
+			t.Errorf("Expected %s but got %s", expectedErr, err.Error())
+		}
+	}
+}
+
+func TestParseString_structuredlogger(t *testing.T) {
+	for _, test := range []struct {
+		script   string
+		expected map[string]interface{}
+	}{
+		{"# ok\nbogus x", map[string]interface{}{
+			"line":       2.0,
+			"command":    "bogus",
+			"error":      "An error occured on line 2: bogus is not a valid command",
+			"error_kind": parser.UnknownCommandErrorKind,
+		}},
+		{"say setup\ntarget build", map[string]interface{}{
+			"line":       2.0,
+			"command":    "target",
+			"error":      "An error occured on line 2: Target build is missing end",
+			"error_kind": ErrorKind,
+		}},
+	} {
+		var buf bytes.Buffer
+		p := newParser()
+		p.SetStructuredLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+		if _, err := ParseString(p, test.script, nil); err == nil {
+			t.Fatalf("Should not be able to parse %q", test.script)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("Expected one record but got %+q", lines)
+		}
+		record := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range test.expected {
+			if record[key] != value {
+				t.Errorf("Expected %v but got %v", value, record[key])
+			}
+		}
+	}
+}
+
+func TestParseFS_noerror(t *testing.T) {
+	fsys := fstest.MapFS{"pakefile": &fstest.MapFile{Data: []byte(script)}}
+	logger := log.New(ioutil.Discard, "", 0)
+
+	g, err := ParseFS(newParser(), fsys, "pakefile", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build, _ := g.Target("build")
+	expectedPosition := pakelib.Position{File: "pakefile", Line: 5}
+	if build.Position != expectedPosition {
+		t.Errorf("Expected %+v but got %+v", expectedPosition, build.Position)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+
+	g, err := ParseString(newParser(), script, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPositions := []pakelib.Position{{Line: 2}, {Line: 6}, {Line: 9}, {Line: 13}}
+	if positions := g.Positions(); !reflect.DeepEqual(positions, expectedPositions) {
+		t.Errorf("Expected %+v but got %+v", expectedPositions, positions)
+	}
+}
+
+func TestPlan_topologicalorder(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	g, _ := ParseString(newParser(), script, logger)
+
+	plan, err := g.Plan("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, target := range plan {
+		names = append(names, target.Name)
+	}
+	expectedNames := []string{"generate", "build", "test", "all"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected %+q but got %+q", expectedNames, names)
+	}
+}
+
+func TestPlan_cycle(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	g, err := ParseString(newParser(), "target a: b\nend\ntarget b: c\nend\ntarget c: b\nend",
+		logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = g.Plan("a")
+	if err == nil {
+		t.Fatal("Expected an error planning a target with a dependency cycle")
+	}
+	expectedErr := "There is a dependency cycle: b -> c -> b"
+	if err.Error() != expectedErr {
+		t.Errorf("Expected %s but got %s", expectedErr, err.Error())
+	}
+}
+
+func TestPlan_unknowntarget(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	g, _ := ParseString(newParser(), script, logger)
+
+	if _, err := g.Plan("deploy"); err == nil {
+		t.Error("Expected an error planning a target that does not exist")
+	}
+}
+
+func TestRun(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	g, err := ParseString(newParser(), script, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Run(executor.New(logger), config.New(), "test", "build"); err != nil {
+		t.Error(err)
+	}
+	expectedLogOutput := "setup\ngenerate\nbuild\ntest\n"
+	if logOutput.String() != expectedLogOutput {
+		t.Errorf("Expected %s but got %s", expectedLogOutput, logOutput.String())
+	}
+}
+
+func TestRun_tracesblocks(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	g, err := ParseString(newParser(), script, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := executor.NewTracer()
+
+	if err := g.Run(executor.New(logger, executor.WithTracer(tracer)), config.New(),
+		"build"); err != nil {
+		t.Error(err)
+	}
+	blocks := make(map[int]string)
+	var names []string
+	for _, span := range tracer.Spans() {
+		if span.Category == "block" {
+			blocks[span.ID] = span.Name
+			continue
+		}
+		names = append(names, blocks[span.Parent]+": "+span.Attributes["args"])
+	}
+	expectedNames := []string{
+		": {}",
+		": {Args:[setup]}",
+		"target generate: {Args:[generate]}",
+		"target build: {Args:[build]}",
+	}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected %+q but got %+q", expectedNames, names)
+	}
+}
+
+func TestRun_coverage(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	g, err := ParseString(newParser(), script, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coverage := executor.NewCoverage()
+
+	if err := g.Run(executor.New(logger, executor.WithCoverage(coverage)), config.New(),
+		"generate"); err != nil {
+		t.Error(err)
+	}
+	expectedLines := []executor.LineCoverage{
+		{Line: 2, Count: 1},
+		{Line: 6, Count: 0},
+		{Line: 9, Count: 1},
+		{Line: 13, Count: 0},
+	}
+	if !reflect.DeepEqual(coverage.Lines(""), expectedLines) {
+		t.Errorf("Expected %+v but got %+v", expectedLines, coverage.Lines(""))
+	}
+}
+
+func TestRun_stopsatfailedtarget(t *testing.T) {
+	logOutput := bytes.Buffer{}
+	logger := log.New(&logOutput, "", 0)
+	g, err := ParseString(newParser(), "target build\n    fail\n    say built\nend\n"+
+		"target test: build\n    say test\nend", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	e := executor.New(logger, executor.WithOnError(func(inv *executor.Invocation, err error) {
+		errs = append(errs, err)
+	}))
+
+	err = g.Run(e, config.New(), "test")
+
+	expectedErr := "Target build failed: There was an error at line 2: Failed"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("Expected %s but got %v", expectedErr, err)
+	}
+	var commandErr *executor.CommandError
+	if !errors.As(err, &commandErr) || commandErr.Position.Line != 2 {
+		t.Errorf("Expected a *executor.CommandError at line 2 but got %+v", err)
+	}
+	expectedLogOutput := "built\n"
+	if logOutput.String() != expectedLogOutput {
+		t.Errorf("Expected %s but got %s", expectedLogOutput, logOutput.String())
+	}
+	if len(errs) != 1 {
+		t.Errorf("Expected one error to be reported but got %+v", errs)
+	}
+}
+
+type commentValidator struct {
+}
+
+func (cv *commentValidator) IsValid(line string) bool {
+	return strings.HasPrefix(line, "# ")
+}
+
+type say struct {
+	Args []string
+}
+
+func newSay(args []string) pakelib.Command {
+	return &say{
+		Args: args,
+	}
+}
+
+func (s *say) Execute(cfg *config.Config, logger *log.Logger) error {
+	logger.Println(strings.Join(s.Args, " "))
+	return nil
+}
+
+type sayValidator struct {
+}
+
+func (sv *sayValidator) CanHandle(line string) bool {
+	return strings.HasPrefix(line, "say ")
+}
+
+func (sv *sayValidator) ValidateArgs(args []string) error {
+	return nil
+}
+
+type fail struct {
+}
+
+func newFail(args []string) pakelib.Command {
+	return &fail{}
+}
+
+func (f *fail) Execute(cfg *config.Config, logger *log.Logger) error {
+	return errors.New("Failed")
+}
+
+type failValidator struct {
+}
+
+func (fv *failValidator) CanHandle(line string) bool {
+	return line == "fail"
+}
+
+func (fv *failValidator) ValidateArgs(args []string) error {
+	return nil
+}
+
+func newParser() *parser.Parser {
+	return parser.New([]pakelib.CommandCandidate{
+		{Validator: &sayValidator{}, Constructor: newSay},
+		{Validator: &failValidator{}, Constructor: newFail},
+	}, &commentValidator{})
+}